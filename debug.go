@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"io/fs"
+	"log"
+	"time"
+)
+
+// Logger is used by Debug() to output log lines. *log.Logger implements this.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Debug wraps fsys so that every Open(), ReadFile(), Stat() and ReadDir() call is logged to
+// logger with the name, the resulting error and how long the call took. If fsys implements
+// OpenFiler or Writer, so does the returned fs.FS and those calls are logged too. This is meant
+// for finding out which files a consumer touches, not for collecting metrics. If logger is nil,
+// log.Default() is used.
+func Debug(fsys fs.FS, logger Logger) fs.FS {
+	if logger == nil {
+		logger = log.Default()
+	}
+	d := &debugFS{fsys: fsys, logger: logger}
+
+	switch fsys.(type) {
+	case Writer:
+		return debugOpenFileWriter{d}
+	case OpenFiler:
+		return debugOpenFiler{d}
+	}
+	return d
+}
+
+type debugFS struct {
+	fsys   fs.FS
+	logger Logger
+}
+
+func (d *debugFS) log(op, name string, start time.Time, err error) {
+	d.logger.Printf("%s(%q): err == %v, took %v", op, name, err, time.Since(start))
+}
+
+// Open implements fs.FS.Open().
+func (d *debugFS) Open(name string) (fs.File, error) {
+	start := time.Now()
+	f, err := d.fsys.Open(name)
+	d.log("Open", name, start, err)
+	return f, err
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (d *debugFS) ReadFile(name string) ([]byte, error) {
+	start := time.Now()
+	b, err := fs.ReadFile(d.fsys, name)
+	d.log("ReadFile", name, start, err)
+	return b, err
+}
+
+// Stat implements fs.StatFS.Stat().
+func (d *debugFS) Stat(name string) (fs.FileInfo, error) {
+	start := time.Now()
+	fi, err := fs.Stat(d.fsys, name)
+	d.log("Stat", name, start, err)
+	return fi, err
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir().
+func (d *debugFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	start := time.Now()
+	entries, err := fs.ReadDir(d.fsys, name)
+	d.log("ReadDir", name, start, err)
+	return entries, err
+}
+
+// openFile must only be called if d.fsys implements OpenFiler.
+func (d *debugFS) openFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	start := time.Now()
+	f, err := d.fsys.(OpenFiler).OpenFile(name, flags, options...)
+	d.log("OpenFile", name, start, err)
+	return f, err
+}
+
+// writeFile must only be called if d.fsys implements Writer.
+func (d *debugFS) writeFile(name string, data []byte, perm fs.FileMode) error {
+	start := time.Now()
+	err := d.fsys.(Writer).WriteFile(name, data, perm)
+	d.log("WriteFile", name, start, err)
+	return err
+}
+
+// debugOpenFiler is returned by Debug() when fsys implements OpenFiler but not Writer.
+type debugOpenFiler struct {
+	*debugFS
+}
+
+// OpenFile implements OpenFiler.OpenFile().
+func (d debugOpenFiler) OpenFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	return d.openFile(name, flags, options...)
+}
+
+// debugOpenFileWriter is returned by Debug() when fsys implements Writer, which includes OpenFiler.
+type debugOpenFileWriter struct {
+	*debugFS
+}
+
+// OpenFile implements OpenFiler.OpenFile().
+func (d debugOpenFileWriter) OpenFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	return d.openFile(name, flags, options...)
+}
+
+// WriteFile implements Writer.WriteFile().
+func (d debugOpenFileWriter) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return d.writeFile(name, data, perm)
+}
@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type recordLogger struct {
+	lines []string
+}
+
+func (r *recordLogger) Printf(format string, v ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf(format, v...))
+}
+
+func TestDebug(t *testing.T) {
+	logger := &recordLogger{}
+	fsys := Debug(MapFS(map[string][]byte{"dir/file.txt": []byte("hello")}), logger)
+
+	calls := []struct {
+		desc    string
+		prefix  string
+		call    func() error
+		wantErr error
+	}{
+		{
+			desc:   "Open",
+			prefix: `Open("dir/file.txt")`,
+			call:   func() error { _, err := fsys.Open("dir/file.txt"); return err },
+		},
+		{
+			desc:   "ReadFile",
+			prefix: `ReadFile("dir/file.txt")`,
+			call:   func() error { _, err := fs.ReadFile(fsys, "dir/file.txt"); return err },
+		},
+		{
+			desc:    "Stat missing",
+			prefix:  `Stat("none.txt")`,
+			call:    func() error { _, err := fs.Stat(fsys, "none.txt"); return err },
+			wantErr: fs.ErrNotExist,
+		},
+		{
+			desc:   "ReadDir",
+			prefix: `ReadDir("dir")`,
+			call:   func() error { _, err := fs.ReadDir(fsys, "dir"); return err },
+		},
+		{
+			desc:   "WriteFile",
+			prefix: `WriteFile("new.txt")`,
+			call:   func() error { return fsys.(Writer).WriteFile("new.txt", []byte("world"), 0644) },
+		},
+	}
+
+	for _, c := range calls {
+		logger.lines = nil
+		err := c.call()
+		switch {
+		case c.wantErr == nil && err != nil:
+			t.Errorf("TestDebug(%s): got err == %s, want err == nil", c.desc, err)
+		case c.wantErr != nil && !errors.Is(err, c.wantErr):
+			t.Errorf("TestDebug(%s): got err == %v, want %v", c.desc, err, c.wantErr)
+		}
+		if len(logger.lines) != 1 {
+			t.Errorf("TestDebug(%s): got %d log lines, want 1: %v", c.desc, len(logger.lines), logger.lines)
+			continue
+		}
+		if !strings.HasPrefix(logger.lines[0], c.prefix) {
+			t.Errorf("TestDebug(%s): got log line %q, want prefix %q", c.desc, logger.lines[0], c.prefix)
+		}
+	}
+}
+
+func TestDebugInterfaces(t *testing.T) {
+	files := fstest.MapFS{"file.txt": &fstest.MapFile{Data: []byte("hello")}}
+
+	tests := []struct {
+		desc          string
+		fsys          fs.FS
+		wantOpenFiler bool
+		wantWriter    bool
+	}{
+		{desc: "fs.FS", fsys: files},
+		{desc: "OpenFiler", fsys: openFilerOnly{files}, wantOpenFiler: true},
+		{desc: "Writer", fsys: NewSimple(), wantOpenFiler: true, wantWriter: true},
+	}
+
+	for _, test := range tests {
+		logger := &recordLogger{}
+		fsys := Debug(test.fsys, logger)
+
+		of, ok := fsys.(OpenFiler)
+		if ok != test.wantOpenFiler {
+			t.Errorf("TestDebugInterfaces(%s): got OpenFiler == %v, want %v", test.desc, ok, test.wantOpenFiler)
+		}
+		w, ok := fsys.(Writer)
+		if ok != test.wantWriter {
+			t.Errorf("TestDebugInterfaces(%s): got Writer == %v, want %v", test.desc, ok, test.wantWriter)
+		}
+
+		want := 0
+		if test.wantOpenFiler {
+			of.OpenFile("file.txt", 0)
+			want++
+		}
+		if test.wantWriter {
+			w.WriteFile("new.txt", []byte("world"), 0644)
+			want++
+		}
+		if len(logger.lines) != want {
+			t.Errorf("TestDebugInterfaces(%s): got %d log lines, want %d: %v", test.desc, len(logger.lines), want, logger.lines)
+		}
+	}
+}
+
+func TestDebugNilLogger(t *testing.T) {
+	fsys := Debug(fstest.MapFS{}, nil)
+
+	if _, err := fsys.Open("none.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestDebugNilLogger: got err == %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,207 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Flatten presents fsys as a single directory. Every file in fsys is listed by ReadDir(".")
+// with its full path as the name, with "/" replaced by sep, so "a/b/c.txt" becomes "a_b_c.txt"
+// when sep is "_". Open(), Stat() and ReadFile() accept those flattened names. Directories are
+// not listed. fsys is walked the first time the returned fs.FS is used, so files added after that
+// are not seen. sep must not be empty or contain "/". If two paths flatten to the same name,
+// such as "a_b" and "a/b" with sep "_", every call returns an error.
+func Flatten(fsys fs.FS, sep string) fs.FS {
+	return &flatFS{fsys: fsys, sep: sep}
+}
+
+type flatFS struct {
+	fsys fs.FS
+	sep  string
+
+	once    sync.Once
+	err     error
+	paths   map[string]string // flattened name -> path in fsys
+	entries []fs.DirEntry     // Sorted by name.
+}
+
+func (f *flatFS) index() error {
+	f.once.Do(func() {
+		if f.sep == "" || strings.Contains(f.sep, "/") {
+			f.err = fmt.Errorf("Flatten() separator(%q) must not be empty or contain '/'", f.sep)
+			return
+		}
+		f.paths = map[string]string{}
+		f.err = fs.WalkDir(f.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			name := strings.ReplaceAll(p, "/", f.sep)
+			if other, ok := f.paths[name]; ok {
+				return fmt.Errorf("Flatten(): %q and %q both flatten to %q", other, p, name)
+			}
+			f.paths[name] = p
+			f.entries = append(f.entries, flatEntry{DirEntry: d, name: name})
+			return nil
+		})
+		sort.Slice(f.entries, func(i, j int) bool { return f.entries[i].Name() < f.entries[j].Name() })
+	})
+	return f.err
+}
+
+// path returns the path in fsys for the flattened name.
+func (f *flatFS) path(op, name string) (string, error) {
+	if err := f.index(); err != nil {
+		return "", err
+	}
+	p, ok := f.paths[name]
+	if !ok {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return p, nil
+}
+
+// Open implements fs.FS.Open().
+func (f *flatFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		if err := f.index(); err != nil {
+			return nil, err
+		}
+		fi, err := fs.Stat(f.fsys, ".")
+		if err != nil {
+			return nil, err
+		}
+		return &flatDir{info: fi, entries: f.entries}, nil
+	}
+
+	p, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return flatFile{File: file, name: name}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir(). Only "." is a directory.
+func (f *flatFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.index(); err != nil {
+		return nil, err
+	}
+	if name != "." {
+		if _, ok := f.paths[name]; ok {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), f.entries...), nil
+}
+
+// Stat implements fs.StatFS.Stat().
+func (f *flatFS) Stat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		if err := f.index(); err != nil {
+			return nil, err
+		}
+		return fs.Stat(f.fsys, ".")
+	}
+	p, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fs.Stat(f.fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	return flatInfo{FileInfo: fi, name: name}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *flatFS) ReadFile(name string) ([]byte, error) {
+	p, err := f.path("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(f.fsys, p)
+}
+
+// flatFile reports its flattened name from Stat().
+type flatFile struct {
+	fs.File
+	name string
+}
+
+func (f flatFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return flatInfo{FileInfo: fi, name: f.name}, nil
+}
+
+type flatInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (f flatInfo) Name() string {
+	return f.name
+}
+
+type flatEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (f flatEntry) Name() string {
+	return f.name
+}
+
+func (f flatEntry) Info() (fs.FileInfo, error) {
+	fi, err := f.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return flatInfo{FileInfo: fi, name: f.name}, nil
+}
+
+// flatDir is the root directory returned by Open(".").
+type flatDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (f *flatDir) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *flatDir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: ErrIsDirectory}
+}
+
+func (f *flatDir) Close() error {
+	return nil
+}
+
+func (f *flatDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remain := f.entries[f.offset:]
+	if n > 0 && len(remain) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(remain) {
+		n = len(remain)
+	}
+	f.offset += n
+	return append([]fs.DirEntry(nil), remain[:n]...), nil
+}
@@ -0,0 +1,79 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestFlatten(t *testing.T) {
+	src := fstest.MapFS{
+		"a/b/c.txt": &fstest.MapFile{Data: []byte("c")},
+		"a/d.txt":   &fstest.MapFile{Data: []byte("d")},
+		"e.txt":     &fstest.MapFile{Data: []byte("e")},
+	}
+	flat := Flatten(src, "__")
+
+	entries, err := fs.ReadDir(flat, ".")
+	if err != nil {
+		t.Fatalf("TestFlatten(ReadDir): got err == %s, want err == nil", err)
+	}
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if diff := pretty.Compare([]string{"a__b__c.txt", "a__d.txt", "e.txt"}, got); diff != "" {
+		t.Errorf("TestFlatten(ReadDir): -want/+got:\n%s", diff)
+	}
+
+	// Round trip every file back into a tree and compare it to the source.
+	simple := NewSimple()
+	for _, e := range entries {
+		b, err := fs.ReadFile(flat, e.Name())
+		if err != nil {
+			t.Fatalf("TestFlatten(ReadFile(%s)): got err == %s, want err == nil", e.Name(), err)
+		}
+		fi, err := fs.Stat(flat, e.Name())
+		if err != nil || fi.Name() != e.Name() {
+			t.Errorf("TestFlatten(Stat(%s)): got (%v, %v), want the flattened name", e.Name(), fi, err)
+		}
+		if err := simple.WriteFile(strings.ReplaceAll(e.Name(), "__", "/"), b, 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, mf := range src {
+		b, err := simple.ReadFile(name)
+		if err != nil || string(b) != string(mf.Data) {
+			t.Errorf("TestFlatten(round trip %s): got (%q, %v), want (%q, nil)", name, string(b), err, string(mf.Data))
+		}
+	}
+
+	if err := fstest.TestFS(flat, "a__b__c.txt", "a__d.txt", "e.txt"); err != nil {
+		t.Errorf("TestFlatten(fstest.TestFS): %s", err)
+	}
+	if _, err := flat.Open("a/d.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestFlatten(Open(a/d.txt)): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFlattenErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		src  fstest.MapFS
+		sep  string
+	}{
+		{desc: "Empty separator", src: fstest.MapFS{"a/b": &fstest.MapFile{}}, sep: ""},
+		{desc: "Separator with a slash", src: fstest.MapFS{"a/b": &fstest.MapFile{}}, sep: "/"},
+		{desc: "Collision", src: fstest.MapFS{"a_b": &fstest.MapFile{}, "a/b": &fstest.MapFile{}}, sep: "_"},
+	}
+
+	for _, test := range tests {
+		if _, err := fs.ReadDir(Flatten(test.src, test.sep), "."); err == nil {
+			t.Errorf("TestFlattenErrors(%s): got err == nil, want err != nil", test.desc)
+		}
+	}
+}
@@ -2,13 +2,25 @@
 package fs
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-const fileMode fs.FileMode = 0444
+const (
+	fileMode       fs.FileMode = 0444
+	defaultDirMode fs.FileMode = 0555
+)
+
+// ErrIsDirectory is returned, wrapped in an *fs.PathError with Op "read", when ReadFile()
+// or a file's Read() is called on a directory.
+var ErrIsDirectory = errors.New("is a directory")
 
 // OFOption is an option for the OpenFiler.OpenFile() call. The passed "o" arge
 // is implementation dependent.
@@ -38,8 +50,85 @@ type Writer interface {
 	WriteFile(name string, data []byte, perm fs.FileMode) error
 }
 
+// MetaWriter provides a Writer that can store metadata with each file. How the metadata is
+// read back is implementation specific, usually through the Sys() method of fs.FileInfo.
+type MetaWriter interface {
+	Writer
+
+	// SetMeta sets the metadata key to value on the file at name, which must exist.
+	SetMeta(name, key, value string) error
+}
+
+// CompareAndSwapper provides an fs.FS that can atomically replace the content of a file.
+type CompareAndSwapper interface {
+	fs.FS
+
+	// CompareAndSwap replaces the content of the existing file at name with new only if its
+	// current content equals old. swapped is false, with a nil error, if the content didn't match.
+	CompareAndSwap(name string, old, new []byte) (swapped bool, err error)
+}
+
+// MetaOriginalSize is the metadata key Merge() uses to record the size of a file before
+// any transform is applied, as a base 10 string.
+const MetaOriginalSize = "original-size"
+
+// MetaContentEncoding is the metadata key WithPrecompressedDetection() uses to record the
+// encoding of a file that was already compressed in the source, such as "gzip" or "br".
+// The value can be used as an HTTP Content-Encoding.
+const MetaContentEncoding = "content-encoding"
+
 type mergeOptions struct {
-	fileTransform FileTransform
+	fileTransform   FileTransform
+	resultTransform ResultTransform
+	filter          func(p string, d fs.DirEntry) bool
+	fingerprint     *fingerprint
+	symlinks        SymlinkPolicy
+	precompressed   bool
+}
+
+// SymlinkPolicy details what Merge() does when it finds a symbolic link in the source.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow reads the file the link points to, wherever that is. This is the default.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkIgnore skips symbolic links.
+	SymlinkIgnore
+	// SymlinkFollowWithinRoot follows links that resolve to a file inside the source and
+	// returns an error for any link that leaves it. The source must implement ReadLinkFS.
+	SymlinkFollowWithinRoot
+	// SymlinkError returns an error if a symbolic link is found.
+	SymlinkError
+)
+
+// ReadLinkFS is implemented by file systems that support symbolic links, such as the one
+// in our os package.
+type ReadLinkFS interface {
+	fs.FS
+
+	// ReadLink returns the destination of the named symbolic link.
+	ReadLink(name string) (string, error)
+	// Lstat returns the fs.FileInfo of name without following a symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+type fingerprint struct {
+	rename   func(base, hashHex string) string
+	record   map[string]string
+	patterns []string
+}
+
+// matches reports if base matches one of the patterns or if there are no patterns.
+func (f *fingerprint) matches(base string) bool {
+	if len(f.patterns) == 0 {
+		return true
+	}
+	for _, pat := range f.patterns {
+		if ok, _ := path.Match(pat, base); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // MergeOption is an optional argument for Merge().
@@ -57,15 +146,148 @@ func WithTransform(ft FileTransform) MergeOption {
 	}
 }
 
+// TransformResult is returned by a ResultTransform.
+type TransformResult struct {
+	// Content is the content to write.
+	Content []byte
+	// Name, if set, is the new base name of the file. The file stays in the same directory.
+	Name string
+	// Meta is metadata to set on the written file. This requires the destination to
+	// implement MetaWriter.
+	Meta map[string]string
+}
+
+// ResultTransform is like FileTransform, but can also rename the file and set metadata on it.
+type ResultTransform func(name string, content []byte) (TransformResult, error)
+
+// WithResultTransform instructs Merge() to use a ResultTransform on the files it reads before
+// writing them to the destination. If WithTransform() is also used, its FileTransform runs first.
+func WithResultTransform(rt ResultTransform) MergeOption {
+	return func(o *mergeOptions) {
+		o.resultTransform = rt
+	}
+}
+
+// WithPrecompressedDetection instructs Merge() to detect files that are already compressed
+// and record their encoding under MetaContentEncoding. Files ending in ".gz" or starting with
+// the gzip magic bytes are "gzip" and files ending in ".br" are "br". Content is not
+// decompressed. Detection uses the source file, before any transform. The destination must
+// implement MetaWriter. A ResultTransform's Meta overrides the detected value.
+func WithPrecompressedDetection() MergeOption {
+	return func(o *mergeOptions) {
+		o.precompressed = true
+	}
+}
+
+// precompressedEncoding returns the encoding of a file that is already compressed or "".
+func precompressedEncoding(name string, b []byte) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return "gzip"
+	case strings.HasSuffix(name, ".br"):
+		return "br"
+	case len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b:
+		return "gzip"
+	}
+	return ""
+}
+
+// WithFilter instructs Merge() to only copy files for which keep returns true. p is the
+// path of the file in the source fs.FS. Directories are always walked.
+func WithFilter(keep func(p string, d fs.DirEntry) bool) MergeOption {
+	return func(o *mergeOptions) {
+		o.filter = keep
+	}
+}
+
+// WithFingerprint instructs Merge() to rename files to include a hash of their content, which
+// is useful for cache busting static web assets. rename receives the base name of the file and
+// the hex encoded SHA256 of the content being written (after any transform) and returns the new
+// base name. If rename is nil, FingerprintName() is used. Each file that is renamed and written
+// is stored in record as original path -> final path, both relative to the root of "into".
+// Merge() returns an error if record is nil.
+// If patterns are provided, only files whose base name matches one of them (using path.Match())
+// are renamed.
+func WithFingerprint(rename func(base, hashHex string) string, record map[string]string, patterns ...string) MergeOption {
+	if rename == nil {
+		rename = FingerprintName
+	}
+	return func(o *mergeOptions) {
+		o.fingerprint = &fingerprint{rename: rename, record: record, patterns: patterns}
+	}
+}
+
+// FingerprintName inserts the first 6 characters of hashHex before the extension of base,
+// such that "app.js" becomes "app.3f9a2c.js".
+func FingerprintName(base, hashHex string) string {
+	if len(hashHex) > 6 {
+		hashHex = hashHex[:6]
+	}
+	ext := path.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + hashHex + ext
+}
+
+// WithSymlinkPolicy sets what Merge() does with symbolic links in the source. Links are
+// detected from the fs.DirEntry type, which file systems without links never set. Links to
+// directories are never descended into.
+func WithSymlinkPolicy(policy SymlinkPolicy) MergeOption {
+	return func(o *mergeOptions) {
+		o.symlinks = policy
+	}
+}
+
 // Merge will merge "from" into "into" by walking "from" the root "/". Each file will be
 // prepended with "prepend" which must start and end with "/". If into does not
 // implement Writer, this will panic. If the file already exists, this will error and
-// leave a partial copied fs.FS.
+// leave a partial copied fs.FS. If into implements MetaWriter, each file has its size
+// before any transform recorded under MetaOriginalSize.
 func Merge(into Writer, from fs.FS, prepend string, options ...MergeOption) error {
+	return merge(into, from, prepend, nil, options...)
+}
+
+// MergeReport details the files written by MergeWithReport().
+type MergeReport struct {
+	// Files has an entry for each file written, in the order they were written.
+	Files []MergedFile
+	// TotalBytes is the sum of the Size of all Files.
+	TotalBytes int64
+}
+
+// MergedFile details a file written by MergeWithReport().
+type MergedFile struct {
+	// Source is the path of the file in the source fs.FS.
+	Source string
+	// Dest is the path the file was written to, after any prepend, rename or fingerprint.
+	Dest string
+	// Size is the number of bytes written, after any transform.
+	Size int64
+	// SHA256 is the hex encoded SHA-256 hash of the bytes written.
+	SHA256 string
+}
+
+// MergeWithReport is like Merge(), but also returns a report of every file written. Files
+// skipped by WithFilter() or a SymlinkPolicy are not in the report. If there is an error,
+// the report has the files that were written before it.
+func MergeWithReport(into Writer, from fs.FS, prepend string, options ...MergeOption) (*MergeReport, error) {
+	report := &MergeReport{}
+	err := merge(into, from, prepend, report, options...)
+	return report, err
+}
+
+// merge implements Merge(). If report is not nil, written files are added to it.
+func merge(into Writer, from fs.FS, prepend string, report *MergeReport, options ...MergeOption) error {
 	opt := mergeOptions{}
 	for _, o := range options {
 		o(&opt)
 	}
+	if opt.fingerprint != nil && opt.fingerprint.record == nil {
+		return fmt.Errorf("WithFingerprint() was passed a nil record map")
+	}
+	if opt.precompressed {
+		if _, ok := into.(MetaWriter); !ok {
+			return fmt.Errorf("WithPrecompressedDetection() requires into to implement MetaWriter, %T does not", into)
+		}
+	}
 
 	if prepend == "/" {
 		prepend = ""
@@ -86,10 +308,46 @@ func Merge(into Writer, from fs.FS, prepend string, options ...MergeOption) erro
 		if d.IsDir() {
 			return nil
 		}
-		b, err := fs.ReadFile(from, p)
+		if opt.filter != nil && !opt.filter(p, d) {
+			return nil
+		}
+		src := p
+		if d.Type()&fs.ModeSymlink != 0 {
+			switch opt.symlinks {
+			case SymlinkIgnore:
+				return nil
+			case SymlinkError:
+				return fmt.Errorf("source file(%s) is a symbolic link", p)
+			case SymlinkFollowWithinRoot:
+				rl, ok := from.(ReadLinkFS)
+				if !ok {
+					return fmt.Errorf("source file(%s) is a symbolic link and %T does not implement ReadLinkFS", p, from)
+				}
+				src, err = resolveWithinRoot(rl, p)
+				if err != nil {
+					return err
+				}
+			}
+			fi, err := fs.Stat(from, src)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+		}
+		b, err := fs.ReadFile(from, src)
 		if err != nil {
 			return err
 		}
+		size := len(b)
+
+		var meta map[string]string
+		if opt.precompressed {
+			if enc := precompressedEncoding(path.Base(p), b); enc != "" {
+				meta = map[string]string{MetaContentEncoding: enc}
+			}
+		}
 
 		if opt.fileTransform != nil {
 			b, err = opt.fileTransform(path.Base(p), b)
@@ -98,8 +356,138 @@ func Merge(into Writer, from fs.FS, prepend string, options ...MergeOption) erro
 			}
 		}
 
-		return into.WriteFile(path.Join(prepend, p), b, d.Type())
+		// fs.ValidPath() names have no leading "/", which prepend adds.
+		dest := strings.TrimPrefix(path.Join(prepend, p), "/")
+		if opt.resultTransform != nil {
+			tr, err := opt.resultTransform(path.Base(p), b)
+			if err != nil {
+				return err
+			}
+			b = tr.Content
+			if tr.Name != "" {
+				if strings.Contains(tr.Name, "/") {
+					return fmt.Errorf("transform for(%s) returned name(%s) that is not a base name", p, tr.Name)
+				}
+				dest = path.Join(path.Dir(dest), tr.Name)
+			}
+			if meta == nil {
+				meta = tr.Meta
+			} else {
+				for k, v := range tr.Meta {
+					meta[k] = v
+				}
+			}
+		}
+		mw, ok := into.(MetaWriter)
+		if !ok && len(meta) > 0 {
+			return fmt.Errorf("file(%s) has metadata, but %T does not implement MetaWriter", p, into)
+		}
+		orig, fingerprinted := dest, false
+		if fp := opt.fingerprint; fp != nil && fp.matches(path.Base(dest)) {
+			sum := sha256.Sum256(b)
+			dest = path.Join(path.Dir(dest), fp.rename(path.Base(dest), hex.EncodeToString(sum[:])))
+			fingerprinted = true
+		}
+		if err := into.WriteFile(dest, b, d.Type()); err != nil {
+			return err
+		}
+		if fingerprinted {
+			opt.fingerprint.record[strings.TrimPrefix(orig, "/")] = strings.TrimPrefix(dest, "/")
+		}
+		if report != nil {
+			sum := sha256.Sum256(b)
+			report.Files = append(report.Files, MergedFile{Source: p, Dest: dest, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])})
+			report.TotalBytes += int64(len(b))
+		}
+		if !ok {
+			return nil
+		}
+		if err := mw.SetMeta(dest, MetaOriginalSize, strconv.Itoa(size)); err != nil {
+			return err
+		}
+		for k, v := range meta {
+			if err := mw.SetMeta(dest, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	return fs.WalkDir(from, ".", fn)
 }
+
+// MergeSource is a source to merge with MergeAll().
+type MergeSource struct {
+	// FS is the file system to merge from.
+	FS fs.FS
+	// Prepend is passed as Merge()'s "prepend" argument.
+	Prepend string
+	// Options are applied after the options passed to MergeAll(), so they can override them.
+	Options []MergeOption
+}
+
+// MergeAll calls Merge() for each source in order. options are applied to every source.
+// A file that already exists from an earlier source causes an error, which leaves a partially
+// merged "into".
+func MergeAll(into Writer, sources []MergeSource, options ...MergeOption) error {
+	for i, src := range sources {
+		opts := append(append([]MergeOption{}, options...), src.Options...)
+		if err := Merge(into, src.FS, src.Prepend, opts...); err != nil {
+			return fmt.Errorf("source(%d) with prepend(%s): %w", i, src.Prepend, err)
+		}
+	}
+	return nil
+}
+
+// maxLinkHops is the number of symbolic links resolveWithinRoot() follows before giving up.
+const maxLinkHops = 40
+
+// resolveWithinRoot returns the path that the symbolic link at p resolves to. It returns an error
+// if the link, or any link it passes through, points outside the root of fsys.
+func resolveWithinRoot(fsys ReadLinkFS, p string) (string, error) {
+	resolved := "."
+	rest := strings.Split(p, "/")
+	hops := 0
+
+	for len(rest) > 0 {
+		c := rest[0]
+		rest = rest[1:]
+
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", fmt.Errorf("symbolic link(%s) points outside the source", p)
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, c)
+		fi, err := fsys.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > maxLinkHops {
+			return "", fmt.Errorf("symbolic link(%s) has too many levels of links", p)
+		}
+		target, err := fsys.ReadLink(next)
+		if err != nil {
+			return "", err
+		}
+		target = filepath.ToSlash(target)
+		if path.IsAbs(target) || filepath.IsAbs(target) {
+			return "", fmt.Errorf("symbolic link(%s) points outside the source to(%s)", p, target)
+		}
+		// The target is relative to the directory holding the link, which is "resolved".
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, nil
+}
@@ -4,12 +4,20 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/md5"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/kylelemons/godebug/pretty"
 )
@@ -37,14 +45,14 @@ func md5Sum(b []byte) string {
 
 func TestMerge(t *testing.T) {
 	simple := NewSimple(WithPearson())
-	simple.WriteFile("/where/the/streets/have/no/name/u2.txt", []byte("joshua tree"), 0660)
+	simple.WriteFile("where/the/streets/have/no/name/u2.txt", []byte("joshua tree"), 0660)
 
 	if err := Merge(simple, FS, "/songs/"); err != nil {
 		panic(err)
 	}
 	simple.RO()
 
-	if err := simple.WriteFile("/some/file", []byte("who cares"), 0660); err == nil {
+	if err := simple.WriteFile("some/file", []byte("who cares"), 0660); err == nil {
 		t.Fatalf("TestMerge(write after .RO()): should not be able to write, but did")
 	}
 
@@ -140,16 +148,16 @@ func TestStat(t *testing.T) {
 	systems := []*Simple{}
 
 	simple := NewSimple()
-	simple.WriteFile("/some/dir/file.txt", []byte("joshua tree"), 0660)
+	simple.WriteFile("some/dir/file.txt", []byte("joshua tree"), 0660)
 	systems = append(systems, simple)
 
 	simple = NewSimple(WithPearson())
-	simple.WriteFile("/some/dir/file.txt", []byte("joshua tree"), 0660)
+	simple.WriteFile("some/dir/file.txt", []byte("joshua tree"), 0660)
 	simple.RO()
 	systems = append(systems, simple)
 
 	for _, system := range systems {
-		stat, err := system.Stat("/some/dir")
+		stat, err := system.Stat("some/dir")
 		if err != nil {
 			t.Fatalf("TestStat: could not Stat the dir: %s", err)
 		}
@@ -200,3 +208,489 @@ func TestSeek(t *testing.T) {
 		t.Fatalf("TestSeek: got string %q, want 'lo world'", string(b))
 	}
 }
+
+func TestMapFS(t *testing.T) {
+	fsys := MapFS(map[string][]byte{"a/b.txt": []byte("b"), "c.txt": []byte("c")})
+
+	if _, ok := fsys.(fs.StatFS); !ok {
+		t.Fatalf("TestMapFS: MapFS() does not implement fs.StatFS")
+	}
+	if _, ok := fsys.(fs.ReadDirFS); !ok {
+		t.Fatalf("TestMapFS: MapFS() does not implement fs.ReadDirFS")
+	}
+	if _, ok := fsys.(fs.ReadFileFS); !ok {
+		t.Fatalf("TestMapFS: MapFS() does not implement fs.ReadFileFS")
+	}
+
+	into := NewSimple()
+	if err := Merge(into, fsys, "/merged/"); err != nil {
+		t.Fatalf("TestMapFS(Merge): got err == %s, want err == nil", err)
+	}
+	for name, want := range map[string]string{"merged/a/b.txt": "b", "merged/c.txt": "c"} {
+		b, err := into.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestMapFS(ReadFile(%s)): got err == %s, want err == nil", name, err)
+		}
+		if string(b) != want {
+			t.Fatalf("TestMapFS(ReadFile(%s)): got %q, want %q", name, string(b), want)
+		}
+	}
+
+	if err := fsys.WriteFile("d.txt", []byte("d"), 0660); err != nil {
+		t.Fatalf("TestMapFS(WriteFile): got err == %s, want err == nil", err)
+	}
+}
+
+func TestMergeOriginalSize(t *testing.T) {
+	gz := func(name string, content []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(content); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	simple := NewSimple()
+	if err := Merge(simple, FS, "/gz/", WithTransform(gz)); err != nil {
+		t.Fatalf("TestMergeOriginalSize(Merge): got err == %s, want err == nil", err)
+	}
+
+	src := mustRead(FS, "fs.go")
+	fi, err := simple.Stat("gz/fs.go")
+	if err != nil {
+		t.Fatalf("TestMergeOriginalSize(Stat): got err == %s, want err == nil", err)
+	}
+	if fi.Size() == int64(len(src)) {
+		t.Fatalf("TestMergeOriginalSize: transform did not change the size, test is broken")
+	}
+	meta, ok := fi.Sys().(map[string]string)
+	if !ok {
+		t.Fatalf("TestMergeOriginalSize: Sys() returned %T, want map[string]string", fi.Sys())
+	}
+	if got, want := meta[MetaOriginalSize], fmt.Sprint(len(src)); got != want {
+		t.Fatalf("TestMergeOriginalSize: got original size %q, want %q", got, want)
+	}
+
+	plain := NewSimple()
+	if err := Merge(plain, FS, "/"); err != nil {
+		t.Fatalf("TestMergeOriginalSize(no transform): got err == %s, want err == nil", err)
+	}
+	fi, err = plain.Stat("fs.go")
+	if err != nil {
+		t.Fatalf("TestMergeOriginalSize(no transform): got err == %s, want err == nil", err)
+	}
+	meta, _ = fi.Sys().(map[string]string)
+	if got, want := meta[MetaOriginalSize], fmt.Sprint(len(src)); got != want {
+		t.Errorf("TestMergeOriginalSize(no transform): got original size %q, want %q", got, want)
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+	upper := func(name string, content []byte) ([]byte, error) {
+		return bytes.ToUpper(content), nil
+	}
+	sources := []MergeSource{
+		{FS: MapFS(map[string][]byte{"a.txt": []byte("a"), "skip.txt": []byte("skip")}), Prepend: "/one/"},
+		{FS: MapFS(map[string][]byte{"b.txt": []byte("b")}), Prepend: "/two/", Options: []MergeOption{WithTransform(upper)}},
+		{FS: MapFS(map[string][]byte{"c/d.txt": []byte("d")}), Prepend: "/"},
+	}
+	noSkip := WithFilter(func(p string, d fs.DirEntry) bool { return p != "skip.txt" })
+
+	simple := NewSimple()
+	if err := MergeAll(simple, sources, noSkip); err != nil {
+		t.Fatalf("TestMergeAll: got err == %s, want err == nil", err)
+	}
+
+	want := map[string]string{"one/a.txt": "a", "two/b.txt": "B", "c/d.txt": "d"}
+	for name, content := range want {
+		b, err := simple.ReadFile(name)
+		if err != nil || string(b) != content {
+			t.Errorf("TestMergeAll(ReadFile(%s)): got (%q, %v), want (%q, nil)", name, string(b), err, content)
+		}
+	}
+	if _, err := simple.Stat("one/skip.txt"); err == nil {
+		t.Errorf("TestMergeAll: filtered file one/skip.txt was merged")
+	}
+
+	if err := MergeAll(simple, sources[:1]); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("TestMergeAll(conflict): got err == %v, want fs.ErrExist", err)
+	}
+}
+
+func TestMergeFingerprint(t *testing.T) {
+	src := MapFS(map[string][]byte{
+		"js/app.js":   []byte("console.log('hi')"),
+		"css/app.css": []byte("body {}"),
+		"index.html":  []byte("<html></html>"),
+	})
+
+	record := map[string]string{}
+	simple := NewSimple()
+	if err := Merge(simple, src, "/static/", WithFingerprint(nil, record, "*.js", "*.css")); err != nil {
+		t.Fatalf("TestMergeFingerprint: got err == %s, want err == nil", err)
+	}
+
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])[:6]
+	}
+	want := map[string]string{
+		"static/js/app.js":   "static/js/app." + hash("console.log('hi')") + ".js",
+		"static/css/app.css": "static/css/app." + hash("body {}") + ".css",
+	}
+	if diff := pretty.Compare(want, record); diff != "" {
+		t.Fatalf("TestMergeFingerprint(record): -want/+got:\n%s", diff)
+	}
+	for _, final := range record {
+		if _, err := simple.Stat(final); err != nil {
+			t.Errorf("TestMergeFingerprint: renamed file %s does not exist: %s", final, err)
+		}
+	}
+	if _, err := simple.Stat("static/index.html"); err != nil {
+		t.Errorf("TestMergeFingerprint: unmatched file was not merged under its own name: %s", err)
+	}
+	if _, err := simple.Stat("static/js/app.js"); err == nil {
+		t.Errorf("TestMergeFingerprint: original name static/js/app.js should not exist")
+	}
+
+	// The fingerprinted css file already exists, so the first write fails and must not be recorded.
+	record = map[string]string{}
+	exists := NewSimple()
+	exists.WriteFile(want["static/css/app.css"], nil, 0660)
+	if err := Merge(exists, src, "/static/", WithFingerprint(nil, record, "*.js", "*.css")); err == nil {
+		t.Fatalf("TestMergeFingerprint(write fails): got err == nil, want err != nil")
+	}
+	if len(record) != 0 {
+		t.Errorf("TestMergeFingerprint(write fails): got record %v, want it empty", record)
+	}
+
+	if err := Merge(NewSimple(), src, "/static/", WithFingerprint(nil, nil)); err == nil {
+		t.Errorf("TestMergeFingerprint(nil record): got err == nil, want err != nil")
+	}
+}
+
+func TestFingerprintName(t *testing.T) {
+	tests := []struct {
+		base, hash, want string
+	}{
+		{"app.js", "3f9a2cdeadbeef", "app.3f9a2c.js"},
+		{"app.min.js", "3f9a2cdeadbeef", "app.min.3f9a2c.js"},
+		{"LICENSE", "3f9a2cdeadbeef", "LICENSE.3f9a2c"},
+		{"a.css", "abc", "a.abc.css"},
+	}
+	for _, test := range tests {
+		if got := FingerprintName(test.base, test.hash); got != test.want {
+			t.Errorf("TestFingerprintName(%s, %s): got %q, want %q", test.base, test.hash, got, test.want)
+		}
+	}
+}
+
+// linkFS is an os.DirFS() that also implements ReadLinkFS.
+type linkFS struct {
+	fs.FS
+	dir string
+}
+
+func newLinkFS(dir string) linkFS {
+	return linkFS{FS: os.DirFS(dir), dir: dir}
+}
+
+func (l linkFS) ReadLink(name string) (string, error) {
+	return os.Readlink(filepath.Join(l.dir, filepath.FromSlash(name)))
+}
+
+func (l linkFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(filepath.Join(l.dir, filepath.FromSlash(name)))
+}
+
+func TestMergeSymlinkPolicy(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	mustDo := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustDo(os.MkdirAll(filepath.Join(root, "real"), 0755))
+	mustDo(os.MkdirAll(filepath.Join(root, "links"), 0755))
+	mustDo(os.WriteFile(filepath.Join(root, "real", "a.txt"), []byte("inside"), 0644))
+	mustDo(os.WriteFile(filepath.Join(base, "secret.txt"), []byte("outside"), 0644))
+	mustDo(os.Symlink("../real/a.txt", filepath.Join(root, "links", "in.txt")))
+
+	outRoot := filepath.Join(base, "out")
+	mustDo(os.MkdirAll(outRoot, 0755))
+	mustDo(os.Symlink("../secret.txt", filepath.Join(outRoot, "out.txt")))
+	mustDo(os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(outRoot, "abs.txt")))
+
+	tests := []struct {
+		desc    string
+		src     string
+		policy  SymlinkPolicy
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			desc:   "Ignore skips the link",
+			src:    root,
+			policy: SymlinkIgnore,
+			want:   map[string]string{"real/a.txt": "inside"},
+		},
+		{
+			desc:    "Error rejects the link",
+			src:     root,
+			policy:  SymlinkError,
+			wantErr: true,
+		},
+		{
+			desc:   "FollowWithinRoot follows an in-root link",
+			src:    root,
+			policy: SymlinkFollowWithinRoot,
+			want:   map[string]string{"real/a.txt": "inside", "links/in.txt": "inside"},
+		},
+		{
+			desc:    "FollowWithinRoot rejects an out-of-root link",
+			src:     outRoot,
+			policy:  SymlinkFollowWithinRoot,
+			wantErr: true,
+		},
+		{
+			desc:   "Default follows any link",
+			src:    outRoot,
+			policy: SymlinkFollow,
+			want:   map[string]string{"out.txt": "outside", "abs.txt": "outside"},
+		},
+	}
+
+	for _, test := range tests {
+		simple := NewSimple()
+		err := Merge(simple, newLinkFS(test.src), "", WithSymlinkPolicy(test.policy))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestMergeSymlinkPolicy(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestMergeSymlinkPolicy(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		got := map[string]string{}
+		fs.WalkDir(simple, ".", func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				got[p] = string(mustRead(simple, p))
+			}
+			return nil
+		})
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestMergeSymlinkPolicy(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestResolveWithinRoot(t *testing.T) {
+	root := t.TempDir()
+	mustDo := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustDo(os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	mustDo(os.WriteFile(filepath.Join(root, "a", "b", "file.txt"), nil, 0644))
+	mustDo(os.Symlink("b", filepath.Join(root, "a", "dirlink")))
+	mustDo(os.Symlink("dirlink/file.txt", filepath.Join(root, "a", "chain.txt")))
+	mustDo(os.Symlink("../..", filepath.Join(root, "a", "escape")))
+	mustDo(os.Symlink("escape/x", filepath.Join(root, "a", "viaescape.txt")))
+	mustDo(os.Symlink("loop2", filepath.Join(root, "loop1")))
+	mustDo(os.Symlink("loop1", filepath.Join(root, "loop2")))
+
+	fsys := newLinkFS(root)
+	got, err := resolveWithinRoot(fsys, "a/chain.txt")
+	if err != nil || got != "a/b/file.txt" {
+		t.Errorf("TestResolveWithinRoot(a/chain.txt): got (%q, %v), want ('a/b/file.txt', nil)", got, err)
+	}
+	for _, p := range []string{"a/viaescape.txt", "loop1"} {
+		if _, err := resolveWithinRoot(fsys, p); err == nil {
+			t.Errorf("TestResolveWithinRoot(%s): got err == nil, want err != nil", p)
+		}
+	}
+}
+
+func TestMergeResultTransform(t *testing.T) {
+	src := MapFS(map[string][]byte{
+		"page":  []byte("<html><body>hi</body></html>"),
+		"image": []byte("\x89PNG\r\n\x1a\n"),
+	})
+
+	sniff := func(name string, content []byte) (TransformResult, error) {
+		ct := http.DetectContentType(content)
+		ext := ".bin"
+		switch {
+		case strings.HasPrefix(ct, "text/html"):
+			ext = ".html"
+		case ct == "image/png":
+			ext = ".png"
+		}
+		return TransformResult{
+			Content: content,
+			Name:    name + ext,
+			Meta:    map[string]string{"content-type": ct},
+		}, nil
+	}
+
+	simple := NewSimple()
+	if err := Merge(simple, src, "/", WithResultTransform(sniff)); err != nil {
+		t.Fatalf("TestMergeResultTransform: got err == %s, want err == nil", err)
+	}
+
+	want := map[string]string{
+		"page.html": "text/html; charset=utf-8",
+		"image.png": "image/png",
+	}
+	for name, ct := range want {
+		fi, err := simple.Stat(name)
+		if err != nil {
+			t.Errorf("TestMergeResultTransform(Stat(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		meta, _ := fi.Sys().(map[string]string)
+		if meta["content-type"] != ct {
+			t.Errorf("TestMergeResultTransform(%s): got content-type %q, want %q", name, meta["content-type"], ct)
+		}
+		if meta[MetaOriginalSize] == "" {
+			t.Errorf("TestMergeResultTransform(%s): original size was not recorded", name)
+		}
+	}
+
+	inner := NewSimple()
+	noMeta := &writerOnly{inner}
+	if err := Merge(noMeta, src, "/", WithResultTransform(sniff)); err == nil {
+		t.Errorf("TestMergeResultTransform(no MetaWriter): got err == nil, want err != nil")
+	}
+	entries, err := inner.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("TestMergeResultTransform(no MetaWriter): got %d files written, want 0", len(entries))
+	}
+}
+
+// writerOnly hides every method of a Simple that is not part of Writer.
+type writerOnly struct {
+	Writer
+}
+
+func TestMergePrecompressedDetection(t *testing.T) {
+	gz, err := GzipTransform(gzip.DefaultCompression)("", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fstest.MapFS{
+		"app.js.gz":  &fstest.MapFile{Data: gz},
+		"font.br":    &fstest.MapFile{Data: []byte("not really brotli")},
+		"data.bin":   &fstest.MapFile{Data: gz},
+		"plain.txt":  &fstest.MapFile{Data: []byte("hello")},
+		"empty.file": &fstest.MapFile{},
+	}
+	want := map[string]string{
+		"app.js.gz":  "gzip",
+		"font.br":    "br",
+		"data.bin":   "gzip",
+		"plain.txt":  "",
+		"empty.file": "",
+	}
+
+	tests := []struct {
+		desc    string
+		options []MergeOption
+		detect  bool
+	}{
+		{desc: "Without option"},
+		{desc: "WithPrecompressedDetection", options: []MergeOption{WithPrecompressedDetection()}, detect: true},
+	}
+
+	for _, test := range tests {
+		simple := NewSimple()
+		if err := Merge(simple, src, "", test.options...); err != nil {
+			t.Fatalf("TestMergePrecompressedDetection(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		for name, enc := range want {
+			if !test.detect {
+				enc = ""
+			}
+			fi, err := simple.Stat(name)
+			if err != nil {
+				t.Fatalf("TestMergePrecompressedDetection(%s): Stat(%s): got err == %s, want err == nil", test.desc, name, err)
+			}
+			meta, _ := fi.Sys().(map[string]string)
+			if meta[MetaContentEncoding] != enc {
+				t.Errorf("TestMergePrecompressedDetection(%s): %s: got encoding %q, want %q", test.desc, name, meta[MetaContentEncoding], enc)
+			}
+		}
+		b, _ := simple.ReadFile("app.js.gz")
+		if !bytes.Equal(b, gz) {
+			t.Errorf("TestMergePrecompressedDetection(%s): app.js.gz content was changed", test.desc)
+		}
+	}
+
+	inner := NewSimple()
+	plain := fstest.MapFS{"plain.txt": &fstest.MapFile{Data: []byte("hello")}}
+	if err := Merge(&writerOnly{inner}, plain, "", WithPrecompressedDetection()); err == nil {
+		t.Errorf("TestMergePrecompressedDetection(no MetaWriter): got err == nil, want err != nil")
+	}
+	if _, err := inner.Stat("plain.txt"); err == nil {
+		t.Errorf("TestMergePrecompressedDetection(no MetaWriter): plain.txt was written before the error")
+	}
+}
+
+func TestMergeWithReport(t *testing.T) {
+	src := fstest.MapFS{
+		"a/keep.txt":   &fstest.MapFile{Data: []byte("keep")},
+		"a/skip.log":   &fstest.MapFile{Data: []byte("skip")},
+		"b/upper.txt":  &fstest.MapFile{Data: []byte("upper")},
+		"b/c/deep.txt": &fstest.MapFile{Data: []byte("deep")},
+	}
+
+	upper := func(name string, content []byte) ([]byte, error) {
+		return bytes.ToUpper(append(content, '!')), nil
+	}
+	noLogs := func(p string, d fs.DirEntry) bool {
+		return !strings.HasSuffix(p, ".log")
+	}
+
+	simple := NewSimple()
+	report, err := MergeWithReport(simple, src, "out/", WithTransform(upper), WithFilter(noLogs))
+	if err != nil {
+		t.Fatalf("TestMergeWithReport: got err == %s, want err == nil", err)
+	}
+
+	want := &MergeReport{}
+	for _, p := range []string{"a/keep.txt", "b/c/deep.txt", "b/upper.txt"} {
+		b, err := simple.ReadFile("out/" + p)
+		if err != nil {
+			t.Fatalf("TestMergeWithReport: ReadFile(out/%s): got err == %s, want err == nil", p, err)
+		}
+		sum := sha256.Sum256(b)
+		want.Files = append(want.Files, MergedFile{Source: p, Dest: "out/" + p, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])})
+		want.TotalBytes += int64(len(b))
+	}
+	if diff := pretty.Compare(want, report); diff != "" {
+		t.Errorf("TestMergeWithReport: -want/+got:\n%s", diff)
+	}
+
+	// On error, the report has what was written before it.
+	report, err = MergeWithReport(simple, src, "out/", WithFilter(noLogs))
+	if err == nil {
+		t.Fatalf("TestMergeWithReport(existing files): got err == nil, want err != nil")
+	}
+	if len(report.Files) != 0 {
+		t.Errorf("TestMergeWithReport(existing files): got %d files in the report, want 0", len(report.Files))
+	}
+}
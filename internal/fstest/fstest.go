@@ -0,0 +1,194 @@
+// Package fstest provides a conformance suite that fs.FS implementations in this module run
+// from their tests to check they behave the way io/fs documents.
+package fstest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"testing"
+	stdfstest "testing/fstest"
+)
+
+// Writer is the method Conform() uses to populate a file system. Implementations must create
+// any parent directories that are missing.
+type Writer interface {
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// Option is an optional argument to Conform().
+type Option func(o *options)
+
+type options struct {
+	ro bool
+}
+
+// WithRO has Conform() call RO() on the file system once the files are written, so the checks
+// run against any lookup indexes RO() builds. The file system must have an RO() method.
+func WithRO() Option {
+	return func(o *options) {
+		o.ro = true
+	}
+}
+
+// Conform calls factory to get a new, empty file system, which must implement Writer, writes
+// files to it and checks that Open(), Stat(), ReadDir() and ReadFile() agree with each other and
+// with what was written. It also runs testing/fstest.TestFS(), which requires that names
+// fs.ValidPath() rejects return an error. Keys in files must be valid paths as reported by
+// fs.ValidPath() and there must be at least one file in a subdirectory.
+func Conform(t *testing.T, factory func() fs.FS, files map[string][]byte, opts ...Option) {
+	t.Helper()
+
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fsys := factory()
+	w, ok := fsys.(Writer)
+	if !ok {
+		t.Fatalf("Conform: %T does not implement WriteFile()", fsys)
+	}
+
+	names := make([]string, 0, len(files))
+	dirs := map[string][]string{} // directory -> base names of children
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := w.WriteFile(name, files[name], 0644); err != nil {
+			t.Fatalf("Conform: WriteFile(%s): got err == %s, want err == nil", name, err)
+		}
+		for p := name; p != "."; p = path.Dir(p) {
+			dir := path.Dir(p)
+			if !contains(dirs[dir], path.Base(p)) {
+				dirs[dir] = append(dirs[dir], path.Base(p))
+			}
+		}
+	}
+
+	if o.ro {
+		ro, ok := fsys.(interface{ RO() })
+		if !ok {
+			t.Fatalf("Conform: WithRO() was passed, but %T does not implement RO()", fsys)
+		}
+		ro.RO()
+	}
+
+	if err := stdfstest.TestFS(fsys, names...); err != nil {
+		t.Errorf("Conform: testing/fstest.TestFS(): %s", err)
+	}
+
+	for _, name := range names {
+		checkFile(t, fsys, name, files[name])
+	}
+	for dir, children := range dirs {
+		checkDir(t, fsys, dir, children)
+	}
+
+	for _, name := range []string{"none.txt", path.Join(path.Dir(names[0]), "none.txt")} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Conform: Open(%s): got err == %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Conform: Stat(%s): got err == %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := fs.ReadFile(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Conform: ReadFile(%s): got err == %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	for _, name := range []string{"../" + names[0], names[0] + "/.."} {
+		if f, err := fsys.Open(name); err == nil {
+			f.Close()
+			t.Errorf("Conform: Open(%s): got err == nil, want an error for an invalid path", name)
+		}
+	}
+	for dir := range dirs {
+		if _, err := fs.ReadFile(fsys, dir); err == nil {
+			t.Errorf("Conform: ReadFile(%s) on a directory: got err == nil, want err != nil", dir)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func checkFile(t *testing.T, fsys fs.FS, name string, want []byte) {
+	t.Helper()
+
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Errorf("Conform: ReadFile(%s): got (%q, %v), want (%q, nil)", name, b, err, want)
+	}
+
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		t.Errorf("Conform: Stat(%s): got err == %s, want err == nil", name, err)
+		return
+	}
+	if fi.Name() != path.Base(name) || fi.Size() != int64(len(want)) || fi.IsDir() || fi.Mode().IsDir() {
+		t.Errorf("Conform: Stat(%s): got (name %q, size %d, dir %v, mode %v), want (name %q, size %d, a file)", name, fi.Name(), fi.Size(), fi.IsDir(), fi.Mode(), path.Base(name), len(want))
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Errorf("Conform: Open(%s): got err == %s, want err == nil", name, err)
+		return
+	}
+	defer f.Close()
+	b, err = io.ReadAll(f)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Errorf("Conform: Open(%s).Read(): got (%q, %v), want (%q, nil)", name, b, err, want)
+	}
+	ffi, err := f.Stat()
+	if err != nil || ffi.Name() != fi.Name() || ffi.Size() != fi.Size() {
+		t.Errorf("Conform: Open(%s).Stat(): got (%v, %v), want it to match Stat()", name, ffi, err)
+	}
+}
+
+func checkDir(t *testing.T, fsys fs.FS, dir string, children []string) {
+	t.Helper()
+
+	fi, err := fs.Stat(fsys, dir)
+	if err != nil || !fi.IsDir() || !fi.Mode().IsDir() {
+		t.Errorf("Conform: Stat(%s): got (%v, %v), want a directory", dir, fi, err)
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		t.Errorf("Conform: ReadDir(%s): got err == %s, want err == nil", dir, err)
+		return
+	}
+	got := make([]string, 0, len(entries))
+	for _, e := range entries {
+		got = append(got, e.Name())
+		if e.IsDir() != (e.Type()&fs.ModeDir != 0) {
+			t.Errorf("Conform: ReadDir(%s): entry %s has IsDir() == %v, but Type() == %v", dir, e.Name(), e.IsDir(), e.Type())
+		}
+	}
+	want := append([]string(nil), children...)
+	sort.Strings(want)
+	if !sort.StringsAreSorted(got) {
+		t.Errorf("Conform: ReadDir(%s): entries are not sorted: %v", dir, got)
+	}
+	if len(got) != len(want) {
+		t.Errorf("Conform: ReadDir(%s): got %v, want %v", dir, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Conform: ReadDir(%s): got %v, want %v", dir, got, want)
+			return
+		}
+	}
+}
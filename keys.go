@@ -0,0 +1,39 @@
+package fs
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ValidateKey returns an *fs.PathError wrapping fs.ErrInvalid if name can't be used as the
+// name of a file in every file system in this module. A valid key satisfies fs.ValidPath(),
+// is not the root (".") and does not contain a NUL byte or a backslash, which some operating
+// systems treat as a separator. Unicode, spaces and dots inside elements, such as ".hidden"
+// or "a..b", are all valid.
+//
+// Simple and RootedFS (in the os package) check every name that creates a file with this.
+// FS in the os package takes native OS paths rather than keys, so it does not use this.
+func ValidateKey(name string) error {
+	if name == "." || !fs.ValidPath(name) || strings.ContainsAny(name, "\x00\\") {
+		return &fs.PathError{Op: "validate", Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// SanitizeKey converts name into a key accepted by ValidateKey(): leading "/" are removed and
+// the path is cleaned, so "/a//b/./c.txt" becomes "a/b/c.txt". Names that can't be converted,
+// such as those with a ".." element, return an error.
+func SanitizeKey(name string) (string, error) {
+	trimmed := strings.TrimLeft(name, "/")
+	for _, e := range strings.Split(trimmed, "/") {
+		if e == ".." {
+			return "", &fs.PathError{Op: "sanitize", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	key := path.Clean(trimmed)
+	if err := ValidateKey(key); err != nil {
+		return "", &fs.PathError{Op: "sanitize", Path: name, Err: fs.ErrInvalid}
+	}
+	return key, nil
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestSanitizeKey(t *testing.T) {
+	tests := []struct {
+		desc    string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{desc: "Plain", name: "a/b.txt", want: "a/b.txt"},
+		{desc: "Leading slash and extra elements", name: "/a//b/./c.txt", want: "a/b/c.txt"},
+		{desc: "Unicode", name: "日本/ファイル.txt", want: "日本/ファイル.txt"},
+		{desc: "Spaces", name: "my dir/my file.txt", want: "my dir/my file.txt"},
+		{desc: "Dots inside elements", name: ".hidden/a..b/c.", want: ".hidden/a..b/c."},
+		{desc: "Root", name: "/", wantErr: true},
+		{desc: "Dot dot", name: "a/../b.txt", wantErr: true},
+		{desc: "Backslash", name: `a\b.txt`, wantErr: true},
+		{desc: "NUL", name: "a\x00b.txt", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := SanitizeKey(test.name)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestSanitizeKey(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestSanitizeKey(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			if !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSanitizeKey(%s): got err == %s, want fs.ErrInvalid", test.desc, err)
+			}
+			if err := NewSimple().WriteFile(test.name, nil, 0660); err == nil {
+				t.Errorf("TestSanitizeKey(%s): Simple.WriteFile(): got err == nil, want err != nil", test.desc)
+			}
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestSanitizeKey(%s): got %q, want %q", test.desc, got, test.want)
+		}
+		if err := ValidateKey(got); err != nil {
+			t.Errorf("TestSanitizeKey(%s): ValidateKey(%q): got err == %s, want err == nil", test.desc, got, err)
+		}
+
+		simple := NewSimple()
+		if test.name != got {
+			if err := simple.WriteFile(test.name, nil, 0660); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSanitizeKey(%s): Simple.WriteFile(%q): got err == %v, want fs.ErrInvalid", test.desc, test.name, err)
+			}
+		}
+		if err := simple.WriteFile(got, []byte(test.want), 0660); err != nil {
+			t.Errorf("TestSanitizeKey(%s): Simple.WriteFile(): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		b, err := simple.ReadFile(got)
+		if err != nil || string(b) != test.want {
+			t.Errorf("TestSanitizeKey(%s): Simple.ReadFile(%q): got (%q, %v), want (%q, nil)", test.desc, got, string(b), err, test.want)
+		}
+	}
+}
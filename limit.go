@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// ErrTooLarge is returned, wrapped in an *fs.PathError, when a file read through LimitReads()
+// is larger than the limit.
+var ErrTooLarge = errors.New("file is larger than the read limit")
+
+// LimitReads wraps fsys so no file larger than maxBytes can be read from it. ReadFile() returns
+// an error wrapping ErrTooLarge without reading if the size reported by Stat() is over the limit. Files
+// returned by Open() stop reading at maxBytes and return an error wrapping ErrTooLarge if there
+// is more, so a store that reports the wrong size still can't exceed the limit.
+// This is useful when reading from a store that isn't trusted.
+func LimitReads(fsys fs.FS, maxBytes int64) fs.FS {
+	return &limitFS{fsys: fsys, max: maxBytes}
+}
+
+type limitFS struct {
+	fsys fs.FS
+	max  int64
+}
+
+// Open implements fs.FS.Open().
+func (l *limitFS) Open(name string) (fs.File, error) {
+	f, err := l.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &limitFile{File: f, name: name, remain: l.max}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (l *limitFS) ReadFile(name string) ([]byte, error) {
+	f, err := l.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > l.max {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrTooLarge}
+	}
+	return io.ReadAll(f)
+}
+
+// Stat implements fs.StatFS.Stat().
+func (l *limitFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(l.fsys, name)
+}
+
+// limitFile is an fs.File that errors if more than remain bytes are read.
+type limitFile struct {
+	fs.File
+	name   string
+	remain int64 // Set to -1 once the limit has been exceeded.
+}
+
+func (l *limitFile) Read(b []byte) (int, error) {
+	if l.remain < 0 {
+		return 0, &fs.PathError{Op: "read", Path: l.name, Err: ErrTooLarge}
+	}
+	// Read one byte past the limit to find out if there is more.
+	if int64(len(b)) > l.remain+1 {
+		b = b[:l.remain+1]
+	}
+	n, err := l.File.Read(b)
+	if int64(n) <= l.remain {
+		l.remain -= int64(n)
+		return n, err
+	}
+	n = int(l.remain)
+	l.remain = -1
+	return n, &fs.PathError{Op: "read", Path: l.name, Err: ErrTooLarge}
+}
+
+// ReadDir implements fs.ReadDirFile.ReadDir() if the wrapped fs.File supports it.
+func (l *limitFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	rd, ok := l.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: l.name, Err: fmt.Errorf("%T does not implement fs.ReadDirFile", l.File)}
+	}
+	return rd.ReadDir(n)
+}
@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// lyingFS reports every file as being 1 byte in size.
+type lyingFS struct {
+	fstest.MapFS
+}
+
+type lyingFile struct {
+	fs.File
+}
+
+type lyingInfo struct {
+	fs.FileInfo
+}
+
+func (l lyingFS) Open(name string) (fs.File, error) {
+	f, err := l.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return lyingFile{f}, nil
+}
+
+func (l lyingFile) Stat() (fs.FileInfo, error) {
+	fi, err := l.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return lyingInfo{fi}, nil
+}
+
+func (l lyingInfo) Size() int64 { return 1 }
+
+func TestLimitReads(t *testing.T) {
+	files := fstest.MapFS{
+		"small.txt": &fstest.MapFile{Data: []byte("hello")},
+		"exact.txt": &fstest.MapFile{Data: []byte("0123456789")},
+		"large.txt": &fstest.MapFile{Data: []byte("hello world, this is too big")},
+	}
+
+	tests := []struct {
+		desc    string
+		fsys    fs.FS
+		name    string
+		wantErr bool
+	}{
+		{desc: "Small file", fsys: files, name: "small.txt"},
+		{desc: "File at the limit", fsys: files, name: "exact.txt"},
+		{desc: "Stat over the limit", fsys: files, name: "large.txt", wantErr: true},
+		{desc: "Lying Stat, small file", fsys: lyingFS{files}, name: "small.txt"},
+		{desc: "Lying Stat, large file", fsys: lyingFS{files}, name: "large.txt", wantErr: true},
+	}
+
+	for _, test := range tests {
+		fsys := LimitReads(test.fsys, 10)
+
+		b, err := fs.ReadFile(fsys, test.name)
+		switch {
+		case test.wantErr && !errors.Is(err, ErrTooLarge):
+			t.Errorf("TestLimitReads(%s): ReadFile(): got err == %v, want ErrTooLarge", test.desc, err)
+		case !test.wantErr && err != nil:
+			t.Errorf("TestLimitReads(%s): ReadFile(): got err == %s, want err == nil", test.desc, err)
+		case !test.wantErr && string(b) != string(files[test.name].Data):
+			t.Errorf("TestLimitReads(%s): ReadFile(): got %q, want %q", test.desc, string(b), string(files[test.name].Data))
+		}
+
+		f, err := fsys.Open(test.name)
+		if err != nil {
+			t.Fatalf("TestLimitReads(%s): Open(): got err == %s, want err == nil", test.desc, err)
+		}
+		b, err = io.ReadAll(f)
+		f.Close()
+		switch {
+		case test.wantErr && !errors.Is(err, ErrTooLarge):
+			t.Errorf("TestLimitReads(%s): Read(): got err == %v, want ErrTooLarge", test.desc, err)
+		case test.wantErr && len(b) != 10:
+			t.Errorf("TestLimitReads(%s): Read(): got %d bytes, want 10", test.desc, len(b))
+		case !test.wantErr && err != nil:
+			t.Errorf("TestLimitReads(%s): Read(): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+
+	entries, err := fs.ReadDir(LimitReads(files, 10), ".")
+	if err != nil || len(entries) != 3 {
+		t.Errorf("TestLimitReads(ReadDir): got (%d entries, %v), want (3, nil)", len(entries), err)
+	}
+}
@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// ErrNotAcceptable is returned, wrapped in an *fs.PathError, by NegotiateEncoding() when the
+// client refuses identity and accepts no variant that exists.
+var ErrNotAcceptable = errors.New("no acceptable content encoding")
+
+// precompressedVariants are the encodings NegotiateEncoding() looks for, in order of preference
+// when the client accepts them equally.
+var precompressedVariants = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// NegotiateEncoding picks which variant of name to serve for an HTTP Accept-Encoding header.
+// If the client accepts it and it exists in fsys, name+".br" is chosen with encoding "br" or
+// name+".gz" with encoding "gzip" ("x-gzip" is treated as "gzip"). Quality values are honored,
+// with brotli preferred on a tie. A variant is only chosen if its quality is at least that of
+// identity, which is set with "identity" or "*" and is otherwise acceptable but least preferred.
+// Otherwise name itself is returned with an empty encoding, meaning identity. If identity was
+// refused with q=0 and no variant is chosen, the error wraps ErrNotAcceptable. The error is
+// also set if identity is chosen and name can't be Stat()ed. Metadata recorded by
+// WithPrecompressedDetection() is not used, only file names.
+func NegotiateEncoding(fsys fs.FS, name, acceptEncoding string) (chosenName, encoding string, err error) {
+	accepted := parseAcceptEncoding(acceptEncoding)
+
+	identityQ, identitySet := accepted["identity"]
+	if !identitySet {
+		identityQ, identitySet = accepted["*"]
+	}
+
+	bestQ := 0.0
+	for _, v := range precompressedVariants {
+		q, ok := accepted[v.encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if !ok || q <= bestQ {
+			continue
+		}
+		fi, err := fs.Stat(fsys, name+v.ext)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		chosenName, encoding, bestQ = name+v.ext, v.encoding, q
+	}
+	if encoding != "" && (!identitySet || bestQ >= identityQ) {
+		return chosenName, encoding, nil
+	}
+
+	if identitySet && identityQ == 0 {
+		return "", "", &fs.PathError{Op: "negotiate", Path: name, Err: ErrNotAcceptable}
+	}
+	if _, err := fs.Stat(fsys, name); err != nil {
+		return "", "", err
+	}
+	return name, "", nil
+}
+
+// parseAcceptEncoding returns the quality value of each coding in an Accept-Encoding header.
+// Codings without a q parameter have a quality of 1. Codings are lower cased and "x-gzip" is
+// recorded as "gzip" unless "gzip" is also listed.
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			if err != nil {
+				v = 0
+			}
+			q = v
+		}
+		accepted[coding] = q
+	}
+	if q, ok := accepted["x-gzip"]; ok {
+		if _, ok := accepted["gzip"]; !ok {
+			accepted["gzip"] = q
+		}
+		delete(accepted, "x-gzip")
+	}
+	return accepted
+}
@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	all := MapFS(map[string][]byte{
+		"app.js":    []byte("js"),
+		"app.js.gz": []byte("gz"),
+		"app.js.br": []byte("br"),
+	})
+	gzOnly := MapFS(map[string][]byte{
+		"app.js":    []byte("js"),
+		"app.js.gz": []byte("gz"),
+	})
+	none := MapFS(map[string][]byte{
+		"app.js": []byte("js"),
+	})
+	variantsOnly := MapFS(map[string][]byte{
+		"app.js.gz": []byte("gz"),
+	})
+
+	tests := []struct {
+		desc         string
+		fsys         fs.FS
+		accept       string
+		wantName     string
+		wantEncoding string
+		wantErr      error
+	}{
+		{desc: "Both accepted, brotli preferred", fsys: all, accept: "gzip, deflate, br", wantName: "app.js.br", wantEncoding: "br"},
+		{desc: "Only gzip accepted", fsys: all, accept: "gzip", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Quality values prefer gzip", fsys: all, accept: "br;q=0.5, gzip;q=0.9", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Brotli refused with q=0", fsys: all, accept: "br;q=0, gzip", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Wildcard", fsys: all, accept: "*", wantName: "app.js.br", wantEncoding: "br"},
+		{desc: "Wildcard with brotli refused", fsys: all, accept: "br;q=0, *;q=0.1", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Case and spaces", fsys: all, accept: " GZIP ; q=1.0 ", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "No header", fsys: all, accept: "", wantName: "app.js"},
+		{desc: "Identity only", fsys: all, accept: "identity", wantName: "app.js"},
+		{desc: "Brotli wanted, only gzip exists", fsys: gzOnly, accept: "br, gzip", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Brotli wanted, no variants", fsys: gzOnly, accept: "br", wantName: "app.js"},
+		{desc: "No variants", fsys: none, accept: "gzip, br", wantName: "app.js"},
+		{desc: "Only a variant exists", fsys: variantsOnly, accept: "gzip", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Only a variant exists, not accepted", fsys: variantsOnly, accept: "br", wantErr: fs.ErrNotExist},
+		{desc: "Identity preferred over gzip", fsys: all, accept: "gzip;q=0.1, identity;q=1", wantName: "app.js"},
+		{desc: "Low gzip, wildcard picks brotli", fsys: all, accept: "gzip;q=0.1, *;q=0.5", wantName: "app.js.br", wantEncoding: "br"},
+		{desc: "Gzip ties identity", fsys: all, accept: "gzip;q=0.5, identity;q=0.5", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Identity refused, variant exists", fsys: all, accept: "gzip, identity;q=0", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "Identity refused", fsys: none, accept: "gzip, identity;q=0", wantErr: ErrNotAcceptable},
+		{desc: "Wildcard refused", fsys: none, accept: "*;q=0", wantErr: ErrNotAcceptable},
+		{desc: "Wildcard refused, identity allowed", fsys: none, accept: "*;q=0, identity", wantName: "app.js"},
+		{desc: "x-gzip", fsys: gzOnly, accept: "x-gzip", wantName: "app.js.gz", wantEncoding: "gzip"},
+		{desc: "x-gzip with gzip refused", fsys: gzOnly, accept: "gzip;q=0, x-gzip", wantName: "app.js"},
+	}
+
+	for _, test := range tests {
+		name, enc, err := NegotiateEncoding(test.fsys, "app.js", test.accept)
+		switch {
+		case test.wantErr != nil:
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("TestNegotiateEncoding(%s): got err == %v, want %v", test.desc, err, test.wantErr)
+			}
+			continue
+		case err != nil:
+			t.Errorf("TestNegotiateEncoding(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if name != test.wantName || enc != test.wantEncoding {
+			t.Errorf("TestNegotiateEncoding(%s): got (%q, %q), want (%q, %q)", test.desc, name, enc, test.wantName, test.wantEncoding)
+		}
+	}
+}
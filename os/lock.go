@@ -0,0 +1,54 @@
+package os
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrLockNotSupported is returned by Lock(), TryLock() and Unlock() on platforms without
+// file locking support.
+var ErrLockNotSupported = errors.New("file locking is not supported on this platform")
+
+// errWouldBlock is returned by lockFile() when block is false and the lock is held elsewhere.
+var errWouldBlock = errors.New("lock is held")
+
+// Lock places an exclusive advisory lock on the file, blocking until it can be acquired.
+// It uses flock() on Unix and LockFileEx() on Windows. Locks are held per open file, so two
+// Opens of the same path, even in the same process, exclude each other. Advisory locks
+// only protect against other callers that also lock.
+func (f *File) Lock() error {
+	if f.closed {
+		return &fs.PathError{Op: "lock", Path: f.file.Name(), Err: fs.ErrClosed}
+	}
+	if err := lockFile(f.file, true); err != nil {
+		return &fs.PathError{Op: "lock", Path: f.file.Name(), Err: err}
+	}
+	return nil
+}
+
+// TryLock is like Lock(), but returns locked == false instead of blocking if the lock is
+// held elsewhere.
+func (f *File) TryLock() (locked bool, err error) {
+	if f.closed {
+		return false, &fs.PathError{Op: "lock", Path: f.file.Name(), Err: fs.ErrClosed}
+	}
+	switch err := lockFile(f.file, false); err {
+	case nil:
+		return true, nil
+	case errWouldBlock:
+		return false, nil
+	default:
+		return false, &fs.PathError{Op: "lock", Path: f.file.Name(), Err: err}
+	}
+}
+
+// Unlock releases a lock taken with Lock() or TryLock(). Closing the file also releases it.
+func (f *File) Unlock() error {
+	if f.closed {
+		return &fs.PathError{Op: "unlock", Path: f.file.Name(), Err: fs.ErrClosed}
+	}
+	if err := unlockFile(f.file); err != nil {
+		return &fs.PathError{Op: "unlock", Path: f.file.Name(), Err: err}
+	}
+	return nil
+}
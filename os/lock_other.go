@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package os
+
+import "os"
+
+func lockFile(f *os.File, block bool) error {
+	return ErrLockNotSupported
+}
+
+func unlockFile(f *os.File) error {
+	return ErrLockNotSupported
+}
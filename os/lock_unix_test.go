@@ -0,0 +1,73 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package os
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(name, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := &FS{}
+
+	open := func() *File {
+		f, err := fsys.Open(name)
+		if err != nil {
+			t.Fatalf("TestLock(Open): got err == %s, want err == nil", err)
+		}
+		return f.(*File)
+	}
+	first, second := open(), open()
+	defer first.Close()
+	defer second.Close()
+
+	if err := first.Lock(); err != nil {
+		t.Fatalf("TestLock(first.Lock): got err == %s, want err == nil", err)
+	}
+	locked, err := second.TryLock()
+	if err != nil || locked {
+		t.Fatalf("TestLock(second.TryLock): got (%v, %v), want (false, nil)", locked, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- second.Lock()
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("TestLock(second.Lock): returned %v while the first lock was held, want it to block", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("TestLock(first.Unlock): got err == %s, want err == nil", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("TestLock(second.Lock): got err == %s, want err == nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestLock(second.Lock): still blocked after first.Unlock()")
+	}
+
+	locked, err = first.TryLock()
+	if err != nil || locked {
+		t.Fatalf("TestLock(first.TryLock): got (%v, %v), want (false, nil)", locked, err)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatalf("TestLock(second.Unlock): got err == %s, want err == nil", err)
+	}
+	locked, err = first.TryLock()
+	if err != nil || !locked {
+		t.Fatalf("TestLock(first.TryLock after Unlock): got (%v, %v), want (true, nil)", locked, err)
+	}
+}
@@ -2,17 +2,22 @@
 package os
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	jsfs "github.com/johnsiilver/fs"
 )
 
 // File implememnts fs.File.
 type File struct {
-	file *os.File
+	file   *os.File
+	closed bool
 }
 
 // OSFile returns the underlying *os.File.
@@ -20,7 +25,15 @@ func (f *File) OSFile() *os.File {
 	return f.file
 }
 
+// ReadDir implements fs.ReadDirFile.ReadDir(). With n > 0, entries are returned in batches of
+// at most n and io.EOF is returned once the directory is exhausted. Entry names are base names,
+// so they never contain a path separator. Calling this after Close() returns an error wrapping
+// fs.ErrClosed.
 func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	// *os.File.ReadDir() returns an internal "use of closed file" error instead of fs.ErrClosed.
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.file.Name(), Err: fs.ErrClosed}
+	}
 	return f.file.ReadDir(n)
 }
 
@@ -41,6 +54,7 @@ func (f *File) Write(b []byte) (n int, err error) {
 }
 
 func (f *File) Close() error {
+	f.closed = true
 	return f.file.Close()
 }
 
@@ -59,7 +73,7 @@ func (f *FS) Open(name string) (fs.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &File{file}, nil
+	return &File{file: file}, nil
 }
 
 // ReadDir implements fs.ReadDirFS.ReadDir().
@@ -76,9 +90,144 @@ func (f *FS) Stat(name string) (fs.FileInfo, error) {
 	return fileInfo{fi}, nil
 }
 
-// ReadFile implements fs.ReadFileFS.ReadFile().
+// Lstat implements jsfs.ReadLinkFS.Lstat(). If name is a symbolic link, the returned
+// fs.FileInfo describes the link itself.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{fi}, nil
+}
+
+// ReadLink implements jsfs.ReadLinkFS.ReadLink().
+func (f *FS) ReadLink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile(). Reading a directory returns an
+// *fs.PathError wrapping jsfs.ErrIsDirectory on all platforms.
 func (f *FS) ReadFile(name string) ([]byte, error) {
-	return os.ReadFile(name)
+	b, err := os.ReadFile(name)
+	if err != nil {
+		if fi, serr := os.Stat(name); serr == nil && fi.IsDir() {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: jsfs.ErrIsDirectory}
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteFileIfAbsent writes data to name only if name does not exist, using O_CREATE|O_EXCL so
+// that the check and the create are atomic. created reports if the file was written. If
+// the write fails after the file was created, the file is removed.
+func (f *FS) WriteFileIfAbsent(name string, data []byte, perm fs.FileMode) (created bool, err error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return false, err
+	}
+	return true, nil
+}
+
+// Touch sets the access and modification times of name to now without changing its content.
+// It returns an error wrapping fs.ErrNotExist if name does not exist.
+func (f *FS) Touch(name string) error {
+	now := time.Now()
+	return os.Chtimes(name, now, now)
+}
+
+// casLocks holds a lock for each absolute path that a CompareAndSwap() call is using. An entry
+// is deleted when the last call holding or waiting for it is done, so the map only grows with
+// the number of paths in use at once. casMu protects casLocks and the refs of every entry.
+var (
+	casMu    sync.Mutex
+	casLocks = map[string]*casLock{}
+)
+
+type casLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockPath locks abs for CompareAndSwap(). The returned func unlocks it.
+func lockPath(abs string) (unlock func()) {
+	casMu.Lock()
+	l, ok := casLocks[abs]
+	if !ok {
+		l = &casLock{}
+		casLocks[abs] = l
+	}
+	l.refs++
+	casMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		casMu.Lock()
+		defer casMu.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(casLocks, abs)
+		}
+	}
+}
+
+// CompareAndSwap implements jsfs.CompareAndSwapper.CompareAndSwap(). The new content is written
+// to a temporary file in the same directory that is renamed over name, so readers see either
+// the old or the new content. The compare and the rename are guarded by a lock for the path
+// that is only held within this process, other processes writing the file are not excluded.
+// A file lock can't be used for this, as it would be held on the file that the rename replaces.
+func (f *FS) CompareAndSwap(name string, old, new []byte) (swapped bool, err error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false, err
+	}
+	defer lockPath(abs)()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false, err
+	}
+	cur, err := f.ReadFile(name)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(cur, old) {
+		return false, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".cas-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly after the rename.
+
+	_, err = tmp.Write(new)
+	if err == nil {
+		err = tmp.Chmod(fi.Mode().Perm())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Glob implements fs.GlobFS.Glob().
@@ -103,7 +252,8 @@ func FileMode(mode fs.FileMode) jsfs.OFOption {
 }
 
 // OpenFile opens a file with the set flags and fs.FileMode. If you want to use the fs.File
-// to write, you need to type assert if to *os.File. If Opening a file for
+// to write, you need to type assert it to *File. Flags are passed to os.OpenFile(), so O_RDWR
+// can be used to read, Seek() and Write() through the same *File.
 func (f *FS) OpenFile(name string, flags int, options ...jsfs.OFOption) (fs.File, error) {
 	opts := ofOptions{}
 	for _, o := range options {
@@ -115,5 +265,5 @@ func (f *FS) OpenFile(name string, flags int, options ...jsfs.OFOption) (fs.File
 	if err != nil {
 		return nil, err
 	}
-	return &File{file}, nil
+	return &File{file: file}, nil
 }
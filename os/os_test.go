@@ -1,6 +1,22 @@
 package os
 
-import "io/fs"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	jsfs "github.com/johnsiilver/fs"
+	jsfstest "github.com/johnsiilver/fs/internal/fstest"
+)
 
 var (
 	_ fs.ReadDirFile = &File{}
@@ -9,4 +25,493 @@ var (
 	_ fs.StatFS     = &FS{}
 	_ fs.ReadFileFS = &FS{}
 	_ fs.GlobFS     = &FS{}
+
+	_ jsfs.ReadLinkFS        = &FS{}
+	_ jsfs.CompareAndSwapper = &FS{}
+
+	_ fs.ReadDirFS  = &RootedFS{}
+	_ fs.StatFS     = &RootedFS{}
+	_ fs.ReadFileFS = &RootedFS{}
+	_ fs.GlobFS     = &RootedFS{}
+	_ jsfs.Writer   = &RootedFS{}
 )
+
+func TestReadFileDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := &FS{}
+	_, err := fsys.ReadFile(dir)
+	var pe *fs.PathError
+	if !errors.Is(err, jsfs.ErrIsDirectory) || !errors.As(err, &pe) || pe.Op != "read" {
+		t.Fatalf("TestReadFileDirectory: got err == %v, want read *fs.PathError wrapping ErrIsDirectory", err)
+	}
+
+	b, err := fsys.ReadFile(filepath.Join(dir, "file.txt"))
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("TestReadFileDirectory(file): got (%q, %v), want ('hello', nil)", string(b), err)
+	}
+
+	if _, err := fsys.ReadFile(filepath.Join(dir, "nope")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("TestReadFileDirectory(missing): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFileReadDirBatches(t *testing.T) {
+	dir := t.TempDir()
+	const total = 1000
+	for i := 0; i < total; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys := &FS{}
+	f, err := fsys.Open(dir)
+	if err != nil {
+		t.Fatalf("TestFileReadDirBatches(Open): got err == %s, want err == nil", err)
+	}
+	rd := f.(fs.ReadDirFile)
+
+	count := 0
+	for {
+		entries, err := rd.ReadDir(64)
+		if len(entries) > 64 {
+			t.Fatalf("TestFileReadDirBatches: got batch of %d entries, want <= 64", len(entries))
+		}
+		for _, e := range entries {
+			if strings.ContainsAny(e.Name(), `/\`) {
+				t.Fatalf("TestFileReadDirBatches: entry name %q contains a separator", e.Name())
+			}
+		}
+		count += len(entries)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("TestFileReadDirBatches(ReadDir): got err == %s, want err == nil", err)
+		}
+		if len(entries) == 0 {
+			t.Fatalf("TestFileReadDirBatches(ReadDir): got no entries and no io.EOF")
+		}
+	}
+	if count != total {
+		t.Fatalf("TestFileReadDirBatches: got %d entries, want %d", count, total)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("TestFileReadDirBatches(Close): got err == %s, want err == nil", err)
+	}
+	if _, err := rd.ReadDir(1); !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("TestFileReadDirBatches(ReadDir after Close): got err == %v, want fs.ErrClosed", err)
+	}
+}
+
+func TestOpenFileRDWR(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.txt")
+	fsys := &FS{}
+
+	f, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE, FileMode(0644))
+	if err != nil {
+		t.Fatalf("TestOpenFileRDWR(OpenFile): got err == %s, want err == nil", err)
+	}
+	file := f.(*File)
+	defer file.Close()
+
+	if _, err := file.Write([]byte("hello world")); err != nil {
+		t.Fatalf("TestOpenFileRDWR(Write): got err == %s, want err == nil", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("TestOpenFileRDWR(Seek): got err == %s, want err == nil", err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(file, b); err != nil || string(b) != "hello" {
+		t.Fatalf("TestOpenFileRDWR(Read): got (%q, %v), want ('hello', nil)", string(b), err)
+	}
+	// Overwrite " world" in place.
+	if _, err := file.Write([]byte(" there")); err != nil {
+		t.Fatalf("TestOpenFileRDWR(second Write): got err == %s, want err == nil", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("TestOpenFileRDWR(second Seek): got err == %s, want err == nil", err)
+	}
+	b, err = io.ReadAll(file)
+	if err != nil || string(b) != "hello there" {
+		t.Fatalf("TestOpenFileRDWR(ReadAll): got (%q, %v), want ('hello there', nil)", string(b), err)
+	}
+
+	if _, err := file.ReadDir(-1); err == nil {
+		t.Fatalf("TestOpenFileRDWR(ReadDir on a file): got err == nil, want err != nil")
+	}
+
+	b, err = fsys.ReadFile(name)
+	if err != nil || string(b) != "hello there" {
+		t.Fatalf("TestOpenFileRDWR(ReadFile): got (%q, %v), want ('hello there', nil)", string(b), err)
+	}
+}
+
+func TestWriteFileIfAbsent(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.txt")
+	fsys := &FS{}
+
+	tests := []struct {
+		desc        string
+		data        string
+		wantCreated bool
+	}{
+		{desc: "File is absent", data: "first", wantCreated: true},
+		{desc: "File is present", data: "second", wantCreated: false},
+	}
+
+	for _, test := range tests {
+		created, err := fsys.WriteFileIfAbsent(name, []byte(test.data), 0644)
+		if err != nil {
+			t.Fatalf("TestWriteFileIfAbsent(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if created != test.wantCreated {
+			t.Errorf("TestWriteFileIfAbsent(%s): got created == %v, want %v", test.desc, created, test.wantCreated)
+		}
+		b, err := fsys.ReadFile(name)
+		if err != nil || string(b) != "first" {
+			t.Errorf("TestWriteFileIfAbsent(%s): got content (%q, %v), want ('first', nil)", test.desc, string(b), err)
+		}
+	}
+}
+
+func TestTouch(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.txt")
+	fsys := &FS{}
+
+	if err := os.WriteFile(name, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.Touch(name); err != nil {
+		t.Fatalf("TestTouch: got err == %s, want err == nil", err)
+	}
+	fi, err := fsys.Stat(name)
+	if err != nil {
+		t.Fatalf("TestTouch(Stat): got err == %s, want err == nil", err)
+	}
+	if time.Since(fi.ModTime()) > time.Hour {
+		t.Errorf("TestTouch: got ModTime %v, want about now", fi.ModTime())
+	}
+
+	if err := fsys.Touch(name + ".none"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestTouch(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestRootedFSKeys(t *testing.T) {
+	rfs, err := Sub(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := []string{"日本/ファイル.txt", "my dir/my file.txt", ".hidden/a..b/c."}
+	for _, key := range valid {
+		if err := jsfs.ValidateKey(key); err != nil {
+			t.Fatalf("TestRootedFSKeys(%s): ValidateKey(): got err == %s, want err == nil", key, err)
+		}
+		if err := os.MkdirAll(filepath.Join(rfs.root, filepath.FromSlash(path.Dir(key))), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := rfs.WriteFile(key, []byte(key), 0644); err != nil {
+			t.Errorf("TestRootedFSKeys(%s): WriteFile(): got err == %s, want err == nil", key, err)
+			continue
+		}
+		b, err := rfs.ReadFile(key)
+		if err != nil || string(b) != key {
+			t.Errorf("TestRootedFSKeys(%s): ReadFile(): got (%q, %v), want (%q, nil)", key, string(b), err, key)
+		}
+	}
+
+	for _, key := range []string{`a\b.txt`, "a\x00b.txt", "."} {
+		if err := rfs.WriteFile(key, nil, 0644); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestRootedFSKeys(%q): WriteFile(): got err == %v, want fs.ErrInvalid", key, err)
+		}
+		if _, err := rfs.OpenFile(key, os.O_WRONLY|os.O_CREATE, FileMode(0644)); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestRootedFSKeys(%q): OpenFile(O_CREATE): got err == %v, want fs.ErrInvalid", key, err)
+		}
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file.txt")
+	fsys := &FS{}
+	if err := os.WriteFile(name, []byte("v1"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc        string
+		name        string
+		old, new    string
+		wantSwapped bool
+		wantErr     bool
+		wantContent string
+	}{
+		{desc: "Match", name: name, old: "v1", new: "v2", wantSwapped: true, wantContent: "v2"},
+		{desc: "Mismatch", name: name, old: "v1", new: "v3", wantContent: "v2"},
+		{desc: "Missing file", name: filepath.Join(dir, "none.txt"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		swapped, err := fsys.CompareAndSwap(test.name, []byte(test.old), []byte(test.new))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestCompareAndSwap(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestCompareAndSwap(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if swapped != test.wantSwapped {
+			t.Errorf("TestCompareAndSwap(%s): got swapped == %v, want %v", test.desc, swapped, test.wantSwapped)
+		}
+		if b, _ := os.ReadFile(test.name); string(b) != test.wantContent {
+			t.Errorf("TestCompareAndSwap(%s): got content %q, want %q", test.desc, string(b), test.wantContent)
+		}
+	}
+	if fi, _ := os.Stat(name); fi.Mode().Perm() != 0640 {
+		t.Errorf("TestCompareAndSwap: got mode %v after swap, want 0640", fi.Mode().Perm())
+	}
+
+	// Each goroutine increments a counter stored in the file until its swap wins.
+	counter := filepath.Join(dir, "counter")
+	if err := os.WriteFile(counter, []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const workers = 10
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				cur, err := fsys.ReadFile(counter)
+				if err != nil {
+					t.Errorf("TestCompareAndSwap(contention): ReadFile(): got err == %s, want err == nil", err)
+					return
+				}
+				var n int
+				fmt.Sscan(string(cur), &n)
+				swapped, err := fsys.CompareAndSwap(counter, cur, []byte(fmt.Sprint(n+1)))
+				if err != nil {
+					t.Errorf("TestCompareAndSwap(contention): got err == %s, want err == nil", err)
+					return
+				}
+				if swapped {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if b, _ := fsys.ReadFile(counter); string(b) != fmt.Sprint(workers) {
+		t.Errorf("TestCompareAndSwap(contention): got counter %q, want %q", string(b), fmt.Sprint(workers))
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("TestCompareAndSwap: got %d files in the directory, want 2 (temporary files were left)", len(entries))
+	}
+	casMu.Lock()
+	defer casMu.Unlock()
+	if len(casLocks) != 0 {
+		t.Errorf("TestCompareAndSwap: got %d path locks after all calls returned, want 0", len(casLocks))
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "empty.txt")
+	fsys := &FS{}
+
+	created, err := fsys.WriteFileIfAbsent(name, nil, 0644)
+	if err != nil || !created {
+		t.Fatalf("TestEmptyFile(WriteFileIfAbsent): got (%v, %v), want (true, nil)", created, err)
+	}
+	b, err := fsys.ReadFile(name)
+	if err != nil || b == nil || len(b) != 0 {
+		t.Errorf("TestEmptyFile(ReadFile): got (%#v, %v), want ([]byte{}, nil)", b, err)
+	}
+	fi, err := fsys.Stat(name)
+	if err != nil || fi.Size() != 0 || fi.IsDir() {
+		t.Errorf("TestEmptyFile(Stat): got (%v, %v), want a file of size 0", fi, err)
+	}
+}
+
+// mkdirRootedFS creates parent directories before writing, as jsfstest.Conform() requires.
+type mkdirRootedFS struct {
+	*RootedFS
+}
+
+func (m mkdirRootedFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Join(m.root, filepath.FromSlash(path.Dir(name))), 0755); err != nil {
+		return err
+	}
+	return m.RootedFS.WriteFile(name, data, perm)
+}
+
+func TestRootedFSConform(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":         []byte("a"),
+		"empty.txt":     nil,
+		"dir/b.txt":     []byte("b"),
+		"dir/sub/c.txt": []byte("c"),
+		"other/e f.txt": []byte("e f"),
+		"other/日本.txt":  []byte("日本"),
+	}
+
+	factory := func() fs.FS {
+		rfs, err := Sub(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mkdirRootedFS{rfs}
+	}
+	jsfstest.Conform(t, factory, files)
+}
+
+func TestLstatReadLink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "file.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(target, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file.txt", link); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := &FS{}
+	fi, err := fsys.Lstat(link)
+	if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+		t.Fatalf("TestLstatReadLink(Lstat): got (%v, %v), want a symbolic link", fi, err)
+	}
+	fi, err = fsys.Stat(link)
+	if err != nil || fi.Mode()&fs.ModeSymlink != 0 {
+		t.Fatalf("TestLstatReadLink(Stat): got (%v, %v), want the link followed", fi, err)
+	}
+	dest, err := fsys.ReadLink(link)
+	if err != nil || dest != "file.txt" {
+		t.Fatalf("TestLstatReadLink(ReadLink): got (%q, %v), want ('file.txt', nil)", dest, err)
+	}
+}
+
+func TestRootedFSReadLink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "root", "configs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "root", "configs", "app.yaml"), []byte("name: app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("configs", "app.yaml"), filepath.Join(dir, "root", "app.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	rfs, err := Sub(filepath.Join(dir, "root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rl jsfs.ReadLinkFS = rfs
+
+	fi, err := rl.Lstat("app.yaml")
+	if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+		t.Fatalf("TestRootedFSReadLink(Lstat): got (%v, %v), want a symbolic link", fi, err)
+	}
+	dest, err := rl.ReadLink("app.yaml")
+	if err != nil || dest != "configs/app.yaml" {
+		t.Fatalf("TestRootedFSReadLink(ReadLink): got (%q, %v), want ('configs/app.yaml', nil)", dest, err)
+	}
+	for _, name := range []string{"../secret", "/app.yaml"} {
+		if _, err := rl.Lstat(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestRootedFSReadLink(Lstat(%s)): got err == %v, want fs.ErrInvalid", name, err)
+		}
+		if _, err := rl.ReadLink(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestRootedFSReadLink(ReadLink(%s)): got err == %v, want fs.ErrInvalid", name, err)
+		}
+	}
+
+	simple := jsfs.NewSimple()
+	if err := jsfs.Merge(simple, rfs, "/", jsfs.WithSymlinkPolicy(jsfs.SymlinkFollowWithinRoot)); err != nil {
+		t.Fatalf("TestRootedFSReadLink(Merge): got err == %s, want err == nil", err)
+	}
+	if b, err := simple.ReadFile("app.yaml"); err != nil || string(b) != "name: app" {
+		t.Errorf("TestRootedFSReadLink(Merge): got (%q, %v), want ('name: app', nil)", string(b), err)
+	}
+
+	if err := os.Symlink(filepath.Join("..", "secret"), filepath.Join(dir, "root", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := jsfs.Merge(jsfs.NewSimple(), rfs, "/", jsfs.WithSymlinkPolicy(jsfs.SymlinkFollowWithinRoot)); err == nil {
+		t.Errorf("TestRootedFSReadLink(Merge with escaping link): got err == nil, want err != nil")
+	}
+}
+
+func TestSub(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"configs/app.yaml":   "name: app",
+		"configs/db/db.yaml": "name: db",
+		"README":             "hello",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rfs, err := Sub(dir)
+	if err != nil {
+		t.Fatalf("TestSub(Sub): got err == %s, want err == nil", err)
+	}
+	if err := fstest.TestFS(rfs, "configs/app.yaml", "configs/db/db.yaml", "README"); err != nil {
+		t.Fatalf("TestSub(fstest.TestFS): %s", err)
+	}
+
+	b, err := rfs.ReadFile("configs/app.yaml")
+	if err != nil || string(b) != "name: app" {
+		t.Fatalf("TestSub(ReadFile): got (%q, %v), want ('name: app', nil)", string(b), err)
+	}
+
+	var w jsfs.Writer = rfs
+	if err := w.WriteFile("configs/new.yaml", []byte("new"), 0644); err != nil {
+		t.Fatalf("TestSub(WriteFile): got err == %s, want err == nil", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "configs", "new.yaml")); err != nil || string(b) != "new" {
+		t.Fatalf("TestSub(WriteFile): file on disk got (%q, %v), want ('new', nil)", string(b), err)
+	}
+
+	for _, name := range []string{"../escape", "/abs", "configs/../README"} {
+		if _, err := rfs.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestSub(Open(%s)): got err == %v, want fs.ErrInvalid", name, err)
+		}
+	}
+
+	_, err = rfs.Open("nope")
+	var pe *fs.PathError
+	if !errors.As(err, &pe) || pe.Path != "nope" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestSub(Open(nope)): got err == %v, want *fs.PathError for 'nope' wrapping fs.ErrNotExist", err)
+	}
+
+	if _, err := Sub(filepath.Join(dir, "README")); err == nil {
+		t.Errorf("TestSub(Sub on a file): got err == nil, want err != nil")
+	}
+}
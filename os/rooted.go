@@ -0,0 +1,171 @@
+package os
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	jsfs "github.com/johnsiilver/fs"
+)
+
+// RootedFS is like FS, but is rooted at a directory, similar to what fs.Sub() provides.
+// Names are slash separated paths relative to the root and must satisfy fs.ValidPath(),
+// so "configs/app.yaml" is the file app.yaml in the configs directory under the root.
+// This is a convenience, not a security boundary: symbolic links are followed wherever
+// they point. It implements fs.ReadDirFS/StatFS/ReadFileFS/GlobFS, jsfs.Writer and
+// jsfs.ReadLinkFS, so jsfs.Merge() can use jsfs.SymlinkFollowWithinRoot to keep links inside it.
+type RootedFS struct {
+	root string
+	fs   FS
+}
+
+// Sub returns a RootedFS rooted at the directory root. root uses the OS path format
+// and must not contain any filepath.Match() special characters.
+func Sub(root string) (*RootedFS, error) {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("root(%s) is not a directory", root)
+	}
+	return &RootedFS{root: root}, nil
+}
+
+// join converts name to an OS path under the root.
+func (r *RootedFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(r.root, filepath.FromSlash(name)), nil
+}
+
+// fixErr makes *fs.PathError errors refer to name instead of the OS path.
+func fixErr(err error, name string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+// Open implements fs.FS.Open().
+func (r *RootedFS) Open(name string) (fs.File, error) {
+	p, err := r.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.fs.Open(p)
+	return f, fixErr(err, name)
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir().
+func (r *RootedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := r.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.fs.ReadDir(p)
+	return entries, fixErr(err, name)
+}
+
+// Stat implements fs.StatFS.Stat().
+func (r *RootedFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := r.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := r.fs.Stat(p)
+	return fi, fixErr(err, name)
+}
+
+// Lstat implements jsfs.ReadLinkFS.Lstat(). If name is a symbolic link, the returned
+// fs.FileInfo describes the link itself.
+func (r *RootedFS) Lstat(name string) (fs.FileInfo, error) {
+	p, err := r.join("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := r.fs.Lstat(p)
+	return fi, fixErr(err, name)
+}
+
+// ReadLink implements jsfs.ReadLinkFS.ReadLink(). The destination is returned as stored in
+// the link, converted to a slash separated path. It is not resolved, so it can point outside
+// the root.
+func (r *RootedFS) ReadLink(name string) (string, error) {
+	p, err := r.join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	dest, err := r.fs.ReadLink(p)
+	if err != nil {
+		return "", fixErr(err, name)
+	}
+	return filepath.ToSlash(dest), nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (r *RootedFS) ReadFile(name string) ([]byte, error) {
+	p, err := r.join("read", name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.fs.ReadFile(p)
+	return b, fixErr(err, name)
+}
+
+// Glob implements fs.GlobFS.Glob().
+func (r *RootedFS) Glob(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(r.root, filepath.FromSlash(pattern)))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, m := range matches {
+		rel, err := filepath.Rel(r.root, m)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		if fs.ValidPath(rel) {
+			out = append(out, rel)
+		}
+	}
+	return out, nil
+}
+
+// OpenFile implements jsfs.OpenFiler.OpenFile(). See FS.OpenFile() for details. If flags
+// contains os.O_CREATE, name must pass jsfs.ValidateKey() as it does for WriteFile().
+func (r *RootedFS) OpenFile(name string, flags int, options ...jsfs.OFOption) (fs.File, error) {
+	if flags&os.O_CREATE != 0 {
+		if err := jsfs.ValidateKey(name); err != nil {
+			return nil, err
+		}
+	}
+	p, err := r.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.fs.OpenFile(p, flags, options...)
+	return f, fixErr(err, name)
+}
+
+// WriteFile implements jsfs.Writer.WriteFile(). Like os.WriteFile(), an existing file is
+// truncated. Parent directories must already exist. name must pass jsfs.ValidateKey().
+func (r *RootedFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := jsfs.ValidateKey(name); err != nil {
+		return err
+	}
+	p, err := r.join("write", name)
+	if err != nil {
+		return err
+	}
+	return fixErr(os.WriteFile(p, data, perm), name)
+}
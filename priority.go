@@ -0,0 +1,98 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Candidate is a source that has a file being looked up by a PriorityFS.
+type Candidate struct {
+	// Index is the index of the source in the slice passed to NewPriorityFS().
+	Index int
+	// Info is the result of fs.Stat() on the file in the source.
+	Info fs.FileInfo
+}
+
+// PickFunc chooses which of the candidates for name should be read. It returns the index in
+// candidates (not the source index) of the chosen candidate. candidates is never empty and is in
+// source order. Returning an error fails the operation with that error.
+type PickFunc func(name string, candidates []Candidate) (int, error)
+
+// PickNewest is a PickFunc that chooses the candidate with the latest ModTime(). Ties go to the
+// earliest source.
+func PickNewest(name string, candidates []Candidate) (int, error) {
+	pick := 0
+	for i, c := range candidates {
+		if c.Info.ModTime().After(candidates[pick].Info.ModTime()) {
+			pick = i
+		}
+	}
+	return pick, nil
+}
+
+// PriorityFS is a read only fs.FS that, for each lookup, chooses which of several sources to read
+// a file from using a PickFunc. Sources are checked lazily, on every call.
+type PriorityFS struct {
+	sources []fs.FS
+	pick    PickFunc
+}
+
+// NewPriorityFS is the constructor for PriorityFS.
+func NewPriorityFS(sources []fs.FS, pick PickFunc) *PriorityFS {
+	return &PriorityFS{sources: sources, pick: pick}
+}
+
+// choose returns the source that should be used for name.
+func (p *PriorityFS) choose(op, name string) (fs.FS, error) {
+	var candidates []Candidate
+	for i, src := range p.sources {
+		fi, err := fs.Stat(src, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		candidates = append(candidates, Candidate{Index: i, Info: fi})
+	}
+	if len(candidates) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	i, err := p.pick(name, candidates)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(candidates) {
+		return nil, fmt.Errorf("PickFunc returned candidate(%d) for(%s), but there are only %d candidates", i, name, len(candidates))
+	}
+	return p.sources[candidates[i].Index], nil
+}
+
+// Open implements fs.FS.Open().
+func (p *PriorityFS) Open(name string) (fs.File, error) {
+	src, err := p.choose("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return src.Open(name)
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (p *PriorityFS) ReadFile(name string) ([]byte, error) {
+	src, err := p.choose("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(src, name)
+}
+
+// Stat implements fs.StatFS.Stat().
+func (p *PriorityFS) Stat(name string) (fs.FileInfo, error) {
+	src, err := p.choose("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(src, name)
+}
@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPriorityFS(t *testing.T) {
+	now := time.Now()
+	older := fstest.MapFS{
+		"both.txt":  &fstest.MapFile{Data: []byte("old"), ModTime: now.Add(-time.Hour)},
+		"older.txt": &fstest.MapFile{Data: []byte("only old"), ModTime: now.Add(-time.Hour)},
+	}
+	newer := fstest.MapFS{
+		"both.txt": &fstest.MapFile{Data: []byte("new"), ModTime: now},
+	}
+
+	tests := []struct {
+		desc    string
+		sources []fs.FS
+		name    string
+		want    string
+	}{
+		{desc: "Newest wins when it is last", sources: []fs.FS{older, newer}, name: "both.txt", want: "new"},
+		{desc: "Newest wins when it is first", sources: []fs.FS{newer, older}, name: "both.txt", want: "new"},
+		{desc: "Only one candidate", sources: []fs.FS{newer, older}, name: "older.txt", want: "only old"},
+	}
+
+	for _, test := range tests {
+		pfs := NewPriorityFS(test.sources, PickNewest)
+
+		b, err := pfs.ReadFile(test.name)
+		if err != nil || string(b) != test.want {
+			t.Errorf("TestPriorityFS(%s): ReadFile() got (%q, %v), want (%q, nil)", test.desc, string(b), err, test.want)
+		}
+		b, err = fs.ReadFile(struct{ fs.FS }{pfs}, test.name)
+		if err != nil || string(b) != test.want {
+			t.Errorf("TestPriorityFS(%s): Open() got (%q, %v), want (%q, nil)", test.desc, string(b), err, test.want)
+		}
+		fi, err := pfs.Stat(test.name)
+		if err != nil || fi.Size() != int64(len(test.want)) {
+			t.Errorf("TestPriorityFS(%s): Stat() got (%v, %v), want size %d", test.desc, fi, err, len(test.want))
+		}
+	}
+
+	pfs := NewPriorityFS([]fs.FS{older, newer}, PickNewest)
+	if _, err := pfs.ReadFile("nope.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestPriorityFS(missing): got err == %v, want fs.ErrNotExist", err)
+	}
+
+	bad := NewPriorityFS([]fs.FS{older}, func(string, []Candidate) (int, error) { return 3, nil })
+	if _, err := bad.Open("both.txt"); err == nil {
+		t.Errorf("TestPriorityFS(out of range pick): got err == nil, want err != nil")
+	}
+
+	var gotCandidates []Candidate
+	record := NewPriorityFS([]fs.FS{older, fstest.MapFS{}, newer}, func(name string, c []Candidate) (int, error) {
+		gotCandidates = c
+		return 0, nil
+	})
+	record.Stat("both.txt")
+	if len(gotCandidates) != 2 || gotCandidates[0].Index != 0 || gotCandidates[1].Index != 2 {
+		t.Errorf("TestPriorityFS(candidates): got %+v, want source indexes [0 2]", gotCandidates)
+	}
+}
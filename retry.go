@@ -0,0 +1,177 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// RetryPolicy details how WithRetry() retries operations that fail.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times an operation is tried, including the
+	// first attempt. Values less than 1 are treated as 1.
+	MaxAttempts int
+	// Backoff is how long to wait before the first retry. Each retry after that doubles
+	// the wait. If 0, retries happen immediately.
+	Backoff time.Duration
+	// MaxBackoff caps the wait between attempts. If 0, the wait is not capped.
+	MaxBackoff time.Duration
+	// Retryable reports if an error should be retried. If nil, no error is retried.
+	// Errors matching fs.ErrNotExist usually should not be retried.
+	Retryable func(err error) bool
+}
+
+func (r RetryPolicy) wait(attempt int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempt && (r.MaxBackoff == 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+	return d
+}
+
+// WithRetry wraps fsys so that failed calls are retried according to policy. This is useful when
+// fsys is a remote store that can have transient errors. Open(), ReadFile() and Stat() are always
+// available, falling back to fs.ReadFile() and fs.Stat() when fsys lacks the matching interface.
+// OpenFile() is only available if fsys implements OpenFiler, WriteFile() if it implements Writer. The
+// time spent is bounded only by the policy, use WithRetryContext() to bound it with a context.
+func WithRetry(fsys fs.FS, policy RetryPolicy) fs.FS {
+	return WithRetryContext(context.Background(), fsys, policy)
+}
+
+// WithRetryContext is WithRetry() but stops retrying once ctx is done. The io/fs interfaces do
+// not take a context, so a call already in progress is not interrupted, but no new attempt is
+// started and the wait between attempts is cut short. The error returned in that case wraps
+// ctx.Err(). ctx applies to every call made on the returned fs.FS, so it is usually scoped to a
+// request or job rather than to the life of the program.
+func WithRetryContext(ctx context.Context, fsys fs.FS, policy RetryPolicy) fs.FS {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	r := &retryFS{ctx: ctx, fsys: fsys, policy: policy}
+
+	switch fsys.(type) {
+	case Writer:
+		return retryOpenFileWriter{r}
+	case OpenFiler:
+		return retryOpenFiler{r}
+	}
+	return r
+}
+
+type retryFS struct {
+	ctx    context.Context
+	fsys   fs.FS
+	policy RetryPolicy
+}
+
+func (r *retryFS) do(fn func() error) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 1; attempt <= r.policy.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if r.policy.Retryable == nil || !r.policy.Retryable(err) {
+			return err
+		}
+		if attempt == r.policy.MaxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(r.policy.wait(attempt))
+		select {
+		case <-timer.C:
+		case <-r.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retries stopped after attempt %d (last error: %v): %w", attempt, err, r.ctx.Err())
+		}
+	}
+	return err
+}
+
+// Open implements fs.FS.Open().
+func (r *retryFS) Open(name string) (fs.File, error) {
+	var f fs.File
+	err := r.do(func() error {
+		var err error
+		f, err = r.fsys.Open(name)
+		return err
+	})
+	return f, err
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (r *retryFS) ReadFile(name string) ([]byte, error) {
+	var b []byte
+	err := r.do(func() error {
+		var err error
+		b, err = fs.ReadFile(r.fsys, name)
+		return err
+	})
+	return b, err
+}
+
+// Stat implements fs.StatFS.Stat().
+func (r *retryFS) Stat(name string) (fs.FileInfo, error) {
+	var fi fs.FileInfo
+	err := r.do(func() error {
+		var err error
+		fi, err = fs.Stat(r.fsys, name)
+		return err
+	})
+	return fi, err
+}
+
+// openFile must only be called if r.fsys implements OpenFiler.
+func (r *retryFS) openFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	of := r.fsys.(OpenFiler)
+	var f fs.File
+	err := r.do(func() error {
+		var err error
+		f, err = of.OpenFile(name, flags, options...)
+		return err
+	})
+	return f, err
+}
+
+// writeFile must only be called if r.fsys implements Writer.
+func (r *retryFS) writeFile(name string, data []byte, perm fs.FileMode) error {
+	w := r.fsys.(Writer)
+	return r.do(func() error {
+		return w.WriteFile(name, data, perm)
+	})
+}
+
+// retryOpenFiler is returned by WithRetryContext() when fsys implements OpenFiler but not Writer.
+type retryOpenFiler struct {
+	*retryFS
+}
+
+// OpenFile implements OpenFiler.OpenFile().
+func (r retryOpenFiler) OpenFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	return r.openFile(name, flags, options...)
+}
+
+// retryOpenFileWriter is returned by WithRetryContext() when fsys implements Writer, which
+// includes OpenFiler.
+type retryOpenFileWriter struct {
+	*retryFS
+}
+
+// OpenFile implements OpenFiler.OpenFile().
+func (r retryOpenFileWriter) OpenFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	return r.openFile(name, flags, options...)
+}
+
+// WriteFile implements Writer.WriteFile().
+func (r retryOpenFileWriter) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return r.writeFile(name, data, perm)
+}
@@ -0,0 +1,221 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var errFlaky = errors.New("flaky")
+
+// flakyFS fails the first "fails" calls to each method before delegating to fsys.
+type flakyFS struct {
+	fsys  fstest.MapFS
+	fails int
+	calls map[string]int
+}
+
+func (f *flakyFS) fail(method string) bool {
+	f.calls[method]++
+	return f.calls[method] <= f.fails
+}
+
+func (f *flakyFS) Open(name string) (fs.File, error) {
+	if f.fail("Open") {
+		return nil, errFlaky
+	}
+	return f.fsys.Open(name)
+}
+
+func (f *flakyFS) ReadFile(name string) ([]byte, error) {
+	if f.fail("ReadFile") {
+		return nil, errFlaky
+	}
+	return f.fsys.ReadFile(name)
+}
+
+func (f *flakyFS) Stat(name string) (fs.FileInfo, error) {
+	if f.fail("Stat") {
+		return nil, errFlaky
+	}
+	return f.fsys.Stat(name)
+}
+
+func (f *flakyFS) OpenFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	return nil, errors.New("not supported")
+}
+
+func (f *flakyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if f.fail("WriteFile") {
+		return errFlaky
+	}
+	f.fsys[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	retryable := func(err error) bool { return errors.Is(err, errFlaky) }
+
+	tests := []struct {
+		desc     string
+		attempts int
+		wantErr  bool
+	}{
+		{desc: "Succeeds on third attempt", attempts: 3},
+		{desc: "Gives up after two attempts", attempts: 2, wantErr: true},
+	}
+
+	for _, test := range tests {
+		flaky := &flakyFS{
+			fsys:  fstest.MapFS{"file.txt": &fstest.MapFile{Data: []byte("hello")}},
+			fails: 2,
+			calls: map[string]int{},
+		}
+		fsys := WithRetry(flaky, RetryPolicy{MaxAttempts: test.attempts, Backoff: time.Millisecond, Retryable: retryable})
+
+		_, err := fsys.Open("file.txt")
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWithRetry(%s): Open(): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWithRetry(%s): Open(): got err == %s, want err == nil", test.desc, err)
+		}
+
+		b, err := fs.ReadFile(fsys, "file.txt")
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWithRetry(%s): ReadFile(): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWithRetry(%s): ReadFile(): got err == %s, want err == nil", test.desc, err)
+		case err == nil && string(b) != "hello":
+			t.Errorf("TestWithRetry(%s): ReadFile(): got %q, want 'hello'", test.desc, string(b))
+		}
+
+		_, err = fs.Stat(fsys, "file.txt")
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWithRetry(%s): Stat(): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWithRetry(%s): Stat(): got err == %s, want err == nil", test.desc, err)
+		}
+
+		err = fsys.(Writer).WriteFile("new.txt", []byte("world"), 0644)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWithRetry(%s): WriteFile(): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWithRetry(%s): WriteFile(): got err == %s, want err == nil", test.desc, err)
+		}
+
+		for method, calls := range flaky.calls {
+			if calls != test.attempts {
+				t.Errorf("TestWithRetry(%s): %s() was called %d times, want %d", test.desc, method, calls, test.attempts)
+			}
+		}
+	}
+}
+
+func TestWithRetryNotRetryable(t *testing.T) {
+	flaky := &flakyFS{fsys: fstest.MapFS{}, fails: 2, calls: map[string]int{}}
+	fsys := WithRetry(flaky, RetryPolicy{MaxAttempts: 5, Retryable: func(err error) bool { return false }})
+
+	if _, err := fsys.Open("file.txt"); !errors.Is(err, errFlaky) {
+		t.Fatalf("TestWithRetryNotRetryable: got err == %v, want errFlaky", err)
+	}
+	if flaky.calls["Open"] != 1 {
+		t.Fatalf("TestWithRetryNotRetryable: Open() called %d times, want 1", flaky.calls["Open"])
+	}
+}
+
+// openFilerOnly implements OpenFiler, but not Writer.
+type openFilerOnly struct {
+	fstest.MapFS
+}
+
+func (o openFilerOnly) OpenFile(name string, flags int, options ...OFOption) (fs.File, error) {
+	return o.Open(name)
+}
+
+func TestWithRetryInterfaces(t *testing.T) {
+	files := fstest.MapFS{"file.txt": &fstest.MapFile{Data: []byte("hello")}}
+
+	tests := []struct {
+		desc          string
+		fsys          fs.FS
+		wantOpenFiler bool
+		wantWriter    bool
+	}{
+		{desc: "fs.FS", fsys: files},
+		{desc: "OpenFiler", fsys: openFilerOnly{files}, wantOpenFiler: true},
+		{desc: "Writer", fsys: &flakyFS{fsys: files, calls: map[string]int{}}, wantOpenFiler: true, wantWriter: true},
+	}
+
+	for _, test := range tests {
+		fsys := WithRetry(test.fsys, RetryPolicy{MaxAttempts: 2})
+
+		of, ok := fsys.(OpenFiler)
+		if ok != test.wantOpenFiler {
+			t.Errorf("TestWithRetryInterfaces(%s): got OpenFiler == %v, want %v", test.desc, ok, test.wantOpenFiler)
+		}
+		w, ok := fsys.(Writer)
+		if ok != test.wantWriter {
+			t.Errorf("TestWithRetryInterfaces(%s): got Writer == %v, want %v", test.desc, ok, test.wantWriter)
+		}
+
+		if _, err := fsys.Open("file.txt"); err != nil {
+			t.Errorf("TestWithRetryInterfaces(%s): Open(): got err == %s, want err == nil", test.desc, err)
+		}
+		if test.wantOpenFiler && !test.wantWriter {
+			if _, err := of.OpenFile("file.txt", 0); err != nil {
+				t.Errorf("TestWithRetryInterfaces(%s): OpenFile(): got err == %s, want err == nil", test.desc, err)
+			}
+		}
+		if test.wantWriter {
+			if err := w.WriteFile("new.txt", []byte("world"), 0644); err != nil {
+				t.Errorf("TestWithRetryInterfaces(%s): WriteFile(): got err == %s, want err == nil", test.desc, err)
+			}
+		}
+	}
+}
+
+func TestWithRetryContext(t *testing.T) {
+	retryable := func(err error) bool { return errors.Is(err, errFlaky) }
+
+	flaky := &flakyFS{fsys: fstest.MapFS{}, fails: 100, calls: map[string]int{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fsys := WithRetryContext(ctx, flaky, RetryPolicy{MaxAttempts: 100, Backoff: time.Hour, Retryable: retryable})
+
+	start := time.Now()
+	_, err := fsys.Open("file.txt")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestWithRetryContext: got err == %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("TestWithRetryContext: Open() waited out the backoff instead of stopping at the deadline")
+	}
+	if flaky.calls["Open"] != 1 {
+		t.Errorf("TestWithRetryContext: Open() called %d times, want 1", flaky.calls["Open"])
+	}
+
+	if _, err := fsys.Open("file.txt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestWithRetryContext(after deadline): got err == %v, want context.DeadlineExceeded", err)
+	}
+	if flaky.calls["Open"] != 1 {
+		t.Errorf("TestWithRetryContext(after deadline): Open() called %d times, want 1", flaky.calls["Open"])
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.wait(i + 1); got != w {
+			t.Errorf("TestRetryPolicyWait(attempt %d): got %v, want %v", i+1, got, w)
+		}
+	}
+}
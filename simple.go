@@ -1,11 +1,14 @@
 package fs
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"log"
 	"os"
+	"path"
 	"sort"
 	"strings"
 	"sync"
@@ -17,16 +20,41 @@ import (
 // Merge() below. It uses "/" unix separators and doesn't deal with any funky "\/" things.
 // If you want to use this don't start trying to get complicated with your pathing.
 // This structure is safe for concurrent reading or concurrent writing, but not concurrent
-// read/write. Once finished writing files, you should call .RO() to lock it.
+// read/write unless WithRWLock() is used. Once finished writing files, you should call .RO() to lock it.
 type Simple struct {
 	root *file
 
-	writeMu sync.Mutex
-	ro      bool
+	writeMu     sync.Mutex
+	ro          bool
+	closed      bool
+	copyOnWrite bool
+
+	// rwMu is only used if rwLock is set.
+	rwMu   sync.RWMutex
+	rwLock bool
 
 	pearson bool
-	cache   []*file
+	cache   [][]pearsonEntry
 	items   int
+
+	useTrie bool
+	trie    *trieNode
+
+	fallback fs.FS
+
+	dirMode fs.FileMode
+
+	maxDepth int
+
+	// names is the string interning table, only set if WithStringInterning() is used.
+	names map[string]string
+}
+
+// pearsonEntry is an entry in the Pearson cache. Entries that hash to the same value are
+// stored in the same bucket, so the full path is needed to tell them apart.
+type pearsonEntry struct {
+	path string
+	f    *file
 }
 
 // SimpleOption provides an optional argument to NewSimple().
@@ -41,58 +69,209 @@ func WithPearson() SimpleOption {
 	}
 }
 
+// WithTrie will build an index at RO() that resolves each path element with a map lookup
+// instead of a binary search of the directory. Unlike WithPearson(), it has no restriction on
+// characters. It also speeds up resolving the fixed prefix of Glob() patterns. If used with
+// WithPearson(), the Pearson cache is used for lookups. See BenchmarkSimpleLookup: on a tree
+// of 10k files, the trie is the fastest for shallow paths (about 5x the tree walk), while the
+// Pearson cache costs the same at any depth and so wins for deep paths. The tree walk is the
+// slowest, but needs no extra memory.
+func WithTrie() SimpleOption {
+	return func(s *Simple) {
+		s.useTrie = true
+	}
+}
+
+// WithFallback causes Open(), ReadFile() and Stat() to look up a name in fallback when it
+// does not exist in the Simple. Writes only go to the Simple, which makes it a lightweight
+// writable overlay on top of something like an embed.FS. Methods that list files, such as
+// ReadDir(), Glob() and Walk(), only see the files in the Simple.
+func WithFallback(fallback fs.FS) SimpleOption {
+	return func(s *Simple) {
+		s.fallback = fallback
+	}
+}
+
+// ErrTooDeep is returned, wrapped in an *fs.PathError, when writing a path deeper than
+// allowed by WithMaxDepth().
+var ErrTooDeep = errors.New("path has too many elements")
+
+// WithMaxDepth causes writes of paths with more than n elements to fail with an error wrapping
+// ErrTooDeep, so "a/b/c.txt" is allowed with n == 3 but not n == 2. This guards against
+// pathological trees when merging untrusted sources. n <= 0 means unlimited, which is the default.
+func WithMaxDepth(n int) SimpleOption {
+	return func(s *Simple) {
+		s.maxDepth = n
+	}
+}
+
+// WithDirMode sets the permission bits reported by directories that WriteFile() creates.
+// Their FileInfo.Mode() is fs.ModeDir | mode. The default is 0555.
+func WithDirMode(mode fs.FileMode) SimpleOption {
+	return func(s *Simple) {
+		s.dirMode = mode.Perm()
+	}
+}
+
+// WithRWLock protects the file system with a sync.RWMutex so that it is safe for concurrent
+// reading and writing. Reads take a read lock and writes take a write lock, so this comes
+// at a performance cost. Without this, Simple should only be read once writes are finished.
+func WithRWLock() SimpleOption {
+	return func(s *Simple) {
+		s.rwLock = true
+	}
+}
+
+// WithStringInterning causes WriteFile() to store a single copy of each distinct directory and
+// file name. This reduces memory for trees with many repeated path segments, such as vendored
+// source trees. It does not change any observable behavior. The interning table is kept until
+// Close() is called.
+func WithStringInterning() SimpleOption {
+	return func(s *Simple) {
+		s.names = map[string]string{}
+	}
+}
+
+// WithCopyOnWrite causes WriteFile() to store a copy of the content it is given, so that
+// later changes to the caller's slice do not change the stored file.
+func WithCopyOnWrite() SimpleOption {
+	return func(s *Simple) {
+		s.copyOnWrite = true
+	}
+}
+
 // NewSimple is the constructor for Simple.
 func NewSimple(options ...SimpleOption) *Simple {
-	return &Simple{root: &file{name: ".", time: time.Now(), isDir: true}}
+	s := &Simple{root: &file{name: ".", time: time.Now(), isDir: true}, dirMode: defaultDirMode}
+	for _, o := range options {
+		o(s)
+	}
+	s.root.perm = s.dirMode
+	return s
 }
 
-// Open implements fs.FS.Open().
+func (s *Simple) rLock() {
+	if s.rwLock {
+		s.rwMu.RLock()
+	}
+}
+
+func (s *Simple) rUnlock() {
+	if s.rwLock {
+		s.rwMu.RUnlock()
+	}
+}
+
+// MapFS returns a writable in-memory file system populated with files, where each key is
+// a file path and each value the file's content. This is a Simple, so the returned Writer
+// also implements fs.StatFS, fs.ReadDirFS and fs.ReadFileFS. It is meant as a one line
+// constructor for tests and panics if a file cannot be written (such as "a" and "a/b"
+// both being keys).
+func MapFS(files map[string][]byte) Writer {
+	s := NewSimple()
+	for name, content := range files {
+		if err := s.WriteFile(name, content, 0660); err != nil {
+			panic(fmt.Sprintf("MapFS: could not write file(%s): %s", name, err))
+		}
+	}
+	return s
+}
+
+// Open implements fs.FS.Open(). Each call returns a new handle with its own offset, so files
+// opened more than once can be read and seeked independently, including from different goroutines.
 func (s *Simple) Open(name string) (fs.File, error) {
-	if name == "/" || name == "" || name == "." {
-		return s.root, nil
+	f, clean, err := s.open("open", name)
+	if err != nil {
+		if s.fallback != nil && errors.Is(err, fs.ErrNotExist) {
+			return s.fallback.Open(clean)
+		}
+		return nil, err
 	}
+	return f, nil
+}
 
-	strings.TrimPrefix(name, ".")
-	strings.TrimPrefix(name, "/")
+// open returns a copy of the *file at name (or the root) and the normalized name.
+func (s *Simple) open(op, name string) (*file, string, error) {
+	clean, err := normalize(op, name)
+	if err != nil {
+		return nil, "", err
+	}
 
-	sp := strings.Split(name, "/")
+	s.rLock()
+	defer s.rUnlock()
 
-	if s.pearson && s.ro {
-		h := pearson([]byte(name))
-		i := int(h) % (len(s.cache) + 1)
-		if i >= len(s.cache) {
-			return nil, fs.ErrNotExist
+	if s.closed {
+		return nil, clean, &fs.PathError{Op: op, Path: name, Err: fs.ErrClosed}
+	}
+	if clean == "." {
+		return s.root.getCopy(s), clean, nil
+	}
+
+	f, err := s.lookup(clean)
+	if err != nil {
+		return nil, clean, err
+	}
+	return f.getCopy(s), clean, nil
+}
+
+// lookup returns the stored *file for name, which must already be normalized. Callers must hold
+// the appropriate lock and must not hand the result to users, as it is not a copy.
+func (s *Simple) lookup(name string) (*file, error) {
+	if name == "." {
+		return s.root, nil
+	}
+
+	if s.cache != nil && s.ro {
+		for _, e := range s.cache[pearson([]byte(name))] {
+			if e.path == name {
+				return e.f, nil
+			}
+		}
+		return nil, fs.ErrNotExist
+	}
+	if s.trie != nil && s.ro {
+		if f := s.trie.find(name); f != nil {
+			return f, nil
 		}
-		return s.cache[i].getCopy(), nil
+		return nil, fs.ErrNotExist
 	}
 
 	dir := s.root
-	for _, p := range sp {
+	for _, p := range strings.Split(name, "/") {
 		f, err := dir.Search(p)
 		if err != nil {
 			return nil, err
 		}
 		dir = f
 	}
-	return dir.getCopy(), nil
+	return dir, nil
 }
 
 func (s *Simple) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.rLock()
+	defer s.rUnlock()
+
+	if s.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrClosed}
+	}
+
 	dir, err := s.findDir(name)
 	if err != nil {
 		return nil, err
 	}
-	return dir.objects, nil
+	// A later write may append to or re-sort the slice after we unlock and callers
+	// must not be able to change the order we search in.
+	return append([]fs.DirEntry(nil), dir.objects...), nil
 }
 
 func (s *Simple) findDir(name string) (*file, error) {
-	switch name {
-	case ".", "", "/":
+	name, err := normalize("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "." {
 		return s.root, nil
 	}
-	name = strings.TrimPrefix(name, ".")
-	name = strings.TrimPrefix(name, "/")
-	name = strings.TrimSuffix(name, "/")
 
 	sp := strings.Split(name, "/")
 
@@ -114,32 +293,37 @@ func (s *Simple) findDir(name string) (*file, error) {
 	return dir, nil
 }
 
-// ReadFile implememnts ReadFileFS.ReadFile(). The slice returned by ReadFile is not
-// a copy of the file's contents like Open().File.Read() returns. Modifying it will
-// modifiy the content so BE CAREFUL.
+// ReadFile implememnts ReadFileFS.ReadFile(). As fs.ReadFileFS requires, the slice returned
+// is a copy of the file's contents, so it can be modified. Use Open() and ReadAt() to avoid
+// the copy.
 func (s *Simple) ReadFile(name string) ([]byte, error) {
-	f, err := s.Open(name)
+	r, clean, err := s.open("read", name)
 	if err != nil {
+		if s.fallback != nil && errors.Is(err, fs.ErrNotExist) {
+			return fs.ReadFile(s.fallback, clean)
+		}
 		return nil, err
 	}
-	r := f.(*file)
 	if r.IsDir() {
-		return nil, errors.New("cannot read a directory")
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrIsDirectory}
 	}
-	return r.content, nil
+	// An empty file returns a non-nil slice, so it can't be confused with a failed read.
+	return append([]byte{}, r.content...), nil
 }
 
 // Stat implements fs.StatFS.Stat().
 func (s *Simple) Stat(name string) (fs.FileInfo, error) {
-	f, err := s.Open(name)
-	if err == nil {
-		return f.Stat()
-	}
-	d, err := s.findDir(name)
+	f, clean, err := s.open("stat", name)
 	if err != nil {
+		if errors.Is(err, fs.ErrInvalid) || errors.Is(err, fs.ErrClosed) {
+			return nil, err
+		}
+		if s.fallback != nil && errors.Is(err, fs.ErrNotExist) {
+			return fs.Stat(s.fallback, clean)
+		}
 		return nil, fs.ErrNotExist
 	}
-	return d.Info()
+	return f.Stat()
 }
 
 // OpenFile implements OpenFiler. Supports flags O_RDONLY, O_WRONLY, O_CREATE, O_TRUNC and O_EXCL.
@@ -148,7 +332,13 @@ func (s *Simple) OpenFile(name string, flags int, options ...OFOption) (fs.File,
 	if isFlagSet(flags, os.O_RDONLY) {
 		return s.Open(name)
 	}
-	if s.ro {
+	s.rLock()
+	closed, ro := s.closed, s.ro
+	s.rUnlock()
+	if closed {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrClosed}
+	}
+	if ro {
 		return nil, fmt.Errorf("in RO mode!")
 	}
 	if !isFlagSet(flags, os.O_WRONLY) {
@@ -188,16 +378,27 @@ func (s *Simple) OpenFile(name string, flags int, options ...OFOption) (fs.File,
 	return &WRFile{f: f.(*file)}, nil
 }
 
+// normalize checks that name can be used to walk the tree and returns it. Like the rest of
+// io/fs, Simple only accepts names that satisfy fs.ValidPath(), so "/a", "a//b" and "a/../b"
+// are rejected with an *fs.PathError wrapping fs.ErrInvalid. op is used in that error. Use
+// SanitizeKey() to convert other names.
+func normalize(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
 func isFlagSet(flags int, flag int) bool {
 	return flags&flag != 0
 }
 
-// WriteFile implememnts Writer. The content reference is copied, so modifying the original will
-// modify it here. perm is ignored. WriteFile is not thread-safe.
+// WriteFile implememnts Writer. By default the content slice is stored as is, not copied, so
+// modifying the original after the call will modify the stored file. Use WithCopyOnWrite() to
+// store a copy instead. perm is ignored. WriteFile is not thread-safe. name must pass
+// ValidateKey(), so names like "/a" or "a//b" and names containing a backslash or NUL byte are
+// rejected. SanitizeKey() converts those that can be.
 func (s *Simple) WriteFile(name string, content []byte, perm fs.FileMode) error {
-	if s.ro {
-		return fmt.Errorf("Simple is locked from writing")
-	}
 	if name == "" {
 		panic("can't write a file at root")
 	}
@@ -206,18 +407,75 @@ func (s *Simple) WriteFile(name string, content []byte, perm fs.FileMode) error
 		return fmt.Errorf("cannot write a file directory(%s)", name)
 	}
 
-	name = strings.TrimPrefix(name, ".")
-	name = strings.TrimPrefix(name, "/")
+	name, err := normalize("write", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return fmt.Errorf("can't write a file at root")
+	}
 
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+	if s.closed {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrClosed}
+	}
+	if s.ro {
+		return fmt.Errorf("Simple is locked from writing")
+	}
+
+	return s.insert(name, content)
+}
+
+// insert adds a file with content at name, which must be normalized, creating any missing
+// directories. name must also pass ValidateKey(). The caller must hold the write locks.
+func (s *Simple) insert(name string, content []byte) error {
+	if err := ValidateKey(name); err != nil {
+		return err
+	}
 
-	dir := s.root
 	sp := strings.Split(name, "/")
+	if s.maxDepth > 0 && len(sp) > s.maxDepth {
+		return &fs.PathError{Op: "write", Path: name, Err: ErrTooDeep}
+	}
+
+	dir, err := s.parentDir(name, sp)
+	if err != nil {
+		return err
+	}
+
+	n := sp[len(sp)-1]
+	if _, err := dir.Search(n); err == nil {
+		return fs.ErrExist
+	}
+
+	if s.copyOnWrite {
+		content = append([]byte{}, content...)
+	}
+	dir.addFile(&file{name: n, content: content, time: time.Now()})
+	s.items++
+
+	return nil
+}
+
+// parentDir returns the directory that should hold name, which has been split into sp,
+// creating any directories that are missing. If string interning is on, the elements of
+// sp are replaced with their interned copies. The caller must hold the write locks.
+func (s *Simple) parentDir(name string, sp []string) (*file, error) {
+	dir := s.root
+	if s.names != nil {
+		for i, seg := range sp {
+			sp[i] = s.intern(seg)
+		}
+	}
 	for i := 0; i < len(sp)-1; i++ {
 		f, err := dir.Search(sp[i])
 		if err != nil {
-			dir.createDir(sp[i])
+			dir.createDir(sp[i], s.dirMode)
 			f, err = dir.Search(sp[i])
 			if err != nil {
 				panic("wtf?")
@@ -226,44 +484,566 @@ func (s *Simple) WriteFile(name string, content []byte, perm fs.FileMode) error
 			continue
 		}
 		if !f.isDir {
-			return fmt.Errorf("name(%s) contains element(%d)(%s) that is not a directory", name, i, sp[i])
+			return nil, fmt.Errorf("name(%s) contains element(%d)(%s) that is not a directory", name, i, sp[i])
 		}
 		dir = f
 	}
+	return dir, nil
+}
 
+// Rename moves the file or directory at oldName, including everything under it, to newName
+// without copying any content. Directories that newName needs are created like WriteFile()
+// does. It is an error if oldName doesn't exist, newName already exists, newName is inside
+// oldName or RO() has been called.
+func (s *Simple) Rename(oldName, newName string) error {
+	oldClean, err := normalize("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newClean, err := normalize("rename", newName)
+	if err != nil {
+		return err
+	}
+	if oldClean == "." || newClean == "." {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: errors.New("cannot rename the root")}
+	}
+	if err := ValidateKey(newClean); err != nil {
+		return err
+	}
+	if newClean == oldClean || strings.HasPrefix(newClean, oldClean+"/") {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fmt.Errorf("cannot move %s inside itself", oldName)}
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+	if s.closed {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrClosed}
+	}
+	if s.ro {
+		return fmt.Errorf("Simple is locked from writing")
+	}
+
+	oldParent, err := s.lookup(path.Dir(oldClean))
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: err}
+	}
+	f, err := oldParent.Search(path.Base(oldClean))
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: err}
+	}
+
+	sp := strings.Split(newClean, "/")
+	if s.maxDepth > 0 && len(sp)+f.height() > s.maxDepth {
+		return &fs.PathError{Op: "rename", Path: newName, Err: ErrTooDeep}
+	}
+	if _, err := s.lookup(newClean); err == nil {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrExist}
+	}
+	// parentDir() creates the missing directories, so it must come after every check that can
+	// fail the rename.
+	newParent, err := s.parentDir(newClean, sp)
+	if err != nil {
+		return err
+	}
 	n := sp[len(sp)-1]
-	if _, err := dir.Search(n); err == nil {
-		return fs.ErrExist
+
+	oldParent.removeFile(f.name)
+	f.name = n
+	newParent.addFile(f)
+	return nil
+}
+
+// WriteFileIfAbsent is like WriteFile(), except that if a file already exists at name it does
+// nothing and returns created == false instead of an error wrapping fs.ErrExist.
+func (s *Simple) WriteFileIfAbsent(name string, content []byte, perm fs.FileMode) (created bool, err error) {
+	err = s.WriteFile(name, content, perm)
+	if errors.Is(err, fs.ErrExist) {
+		if fi, serr := s.Stat(name); serr == nil && fi.IsDir() {
+			return false, &fs.PathError{Op: "write", Path: name, Err: ErrIsDirectory}
+		}
+		return false, nil
 	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	dir.addFile(&file{name: n, content: content, time: time.Now()})
-	s.items++
+// intern returns the shared copy of name, storing a copy if this is the first time it is seen.
+// The copy keeps the stored name from holding a reference to the whole path it was split from.
+// Must be called while holding writeMu.
+func (s *Simple) intern(name string) string {
+	if v, ok := s.names[name]; ok {
+		return v
+	}
+	v := string([]byte(name))
+	s.names[v] = v
+	return v
+}
+
+// Glob implements fs.GlobFS.Glob(). Everything before the first path element containing a
+// wildcard is resolved directly (using the Pearson cache if enabled), then only the entries
+// of the directories that could match are checked. As with fs.Glob(), "**" has no special
+// meaning and matches the same as "*". As with Open(), ".." is not resolved, so a pattern
+// containing it matches nothing. The only possible errors are path.ErrBadPattern and, once
+// Close() has been called, an error wrapping fs.ErrClosed.
+func (s *Simple) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	pattern = strings.TrimLeft(pattern, "/")
+	if pattern == "" {
+		return nil, nil
+	}
+
+	segs := strings.Split(pattern, "/")
+	i := 0
+	for ; i < len(segs)-1 && !hasMeta(segs[i]); i++ {
+	}
+	// Not path.Join(), which would resolve ".." instead of letting normalize() reject it.
+	prefix := strings.Join(segs[:i], "/")
+	if prefix == "" {
+		prefix = "."
+	}
+
+	s.rLock()
+	defer s.rUnlock()
+
+	if s.closed {
+		return nil, &fs.PathError{Op: "glob", Path: pattern, Err: fs.ErrClosed}
+	}
+	clean, err := normalize("glob", prefix)
+	if err != nil {
+		return nil, nil
+	}
+	dir, err := s.lookup(clean)
+	if err != nil {
+		return nil, nil
+	}
+
+	var matches []string
+	globDir(dir, clean, segs[i:], &matches)
+	return matches, nil
+}
+
+// globDir adds to matches the paths below dir, which is at dirPath, that match segs.
+func globDir(dir *file, dirPath string, segs []string, matches *[]string) {
+	if !dir.isDir {
+		return
+	}
+	seg := segs[0]
+
+	var children []*file
+	if !hasMeta(seg) {
+		if f, err := dir.Search(seg); err == nil {
+			children = append(children, f)
+		}
+	} else {
+		for _, o := range dir.objects {
+			f := o.(*file)
+			if ok, _ := path.Match(seg, f.name); ok {
+				children = append(children, f)
+			}
+		}
+	}
+
+	for _, f := range children {
+		p := path.Join(dirPath, f.name)
+		if len(segs) == 1 {
+			*matches = append(*matches, p)
+			continue
+		}
+		globDir(f, p, segs[1:], matches)
+	}
+}
 
+// hasMeta reports if pattern contains any of the special characters used by path.Match().
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// WalkEntry is an entry passed to the function given to Simple.Walk().
+type WalkEntry struct {
+	// FullPath is the path of the entry from the root of the Simple.
+	FullPath string
+	// Depth is how many directories below the root passed to Walk() the entry is. The
+	// root itself is 0.
+	Depth int
+	// IsDir indicates if the entry is a directory.
+	IsDir bool
+
+	f *file
+}
+
+// Info returns the fs.FileInfo for the entry.
+func (w WalkEntry) Info() (fs.FileInfo, error) {
+	return w.f.Info()
+}
+
+// Walk walks the tree at root in lexical order, calling fn for each file and directory,
+// including root. If fn returns fs.SkipDir for a directory, its contents are skipped. If
+// fn returns fs.SkipDir for a file, the remaining entries in that file's directory are
+// skipped. Any other error stops the walk and is returned.
+func (s *Simple) Walk(root string, fn func(e WalkEntry) error) error {
+	clean, err := normalize("walk", root)
+	if err != nil {
+		return err
+	}
+
+	s.rLock()
+	if s.closed {
+		s.rUnlock()
+		return &fs.PathError{Op: "walk", Path: root, Err: fs.ErrClosed}
+	}
+	f, err := s.lookup(clean)
+	s.rUnlock()
+	if err != nil {
+		return &fs.PathError{Op: "walk", Path: root, Err: err}
+	}
+
+	err = s.walk(WalkEntry{FullPath: clean, IsDir: f.isDir, f: f}, fn)
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (s *Simple) walk(e WalkEntry, fn func(e WalkEntry) error) error {
+	if err := fn(e); err != nil || !e.IsDir {
+		return err
+	}
+
+	// Copy the entries so fn can write to the Simple when WithRWLock() is used.
+	s.rLock()
+	objects := append([]fs.DirEntry(nil), e.f.objects...)
+	s.rUnlock()
+
+	for _, o := range objects {
+		child := o.(*file)
+		ce := WalkEntry{
+			FullPath: path.Join(e.FullPath, child.name),
+			Depth:    e.Depth + 1,
+			IsDir:    child.isDir,
+			f:        child,
+		}
+		if err := s.walk(ce, fn); err != nil {
+			if err == fs.SkipDir {
+				if ce.IsDir {
+					continue
+				}
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMeta implements MetaWriter.SetMeta(). Metadata is returned as a map[string]string from
+// the Sys() method of the file's fs.FileInfo.
+func (s *Simple) SetMeta(name, key, value string) error {
+	clean, err := normalize("setmeta", name)
+	if err != nil {
+		return err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+	if s.closed {
+		return &fs.PathError{Op: "setmeta", Path: name, Err: fs.ErrClosed}
+	}
+	if s.ro {
+		return fmt.Errorf("Simple is locked from writing")
+	}
+
+	f, err := s.lookup(clean)
+	if err != nil {
+		return &fs.PathError{Op: "setmeta", Path: name, Err: err}
+	}
+
+	// Copies returned by Open() share the map, so it is replaced instead of modified.
+	meta := make(map[string]string, len(f.meta)+1)
+	for k, v := range f.meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	f.meta = meta
+	return nil
+}
+
+// Patch adds a single file to the Simple, even after RO() has been called. The Pearson cache
+// and trie are updated for the new file and any directories created for it, instead of being
+// rebuilt. This is meant for adding a late file or two, such as a generated index, not for
+// regular writes. If other goroutines may be reading at the same time, WithRWLock() must be
+// used. The content is stored the same way as WriteFile() stores it.
+func (s *Simple) Patch(name string, content []byte) error {
+	if strings.HasSuffix(name, "/") {
+		return fmt.Errorf("cannot write a file directory(%s)", name)
+	}
+	clean, err := normalize("patch", name)
+	if err != nil {
+		return err
+	}
+	if clean == "." {
+		return fmt.Errorf("can't write a file at root")
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+	if s.closed {
+		return &fs.PathError{Op: "patch", Path: name, Err: fs.ErrClosed}
+	}
+
+	if err := s.insert(clean, content); err != nil {
+		return err
+	}
+	if !s.ro {
+		return nil
+	}
+
+	// Add the file and any new directories to the indexes built by RO().
+	dir, node := s.root, s.trie
+	sp := strings.Split(clean, "/")
+	for i, seg := range sp {
+		f, err := dir.Search(seg)
+		if err != nil {
+			panic(fmt.Sprintf("bug: file we just inserted is missing: %s", err))
+		}
+		dir = f
+
+		if s.cache != nil {
+			p := strings.Join(sp[:i+1], "/")
+			h := pearson([]byte(p))
+			found := false
+			for _, e := range s.cache[h] {
+				if e.path == p {
+					found = true
+					break
+				}
+			}
+			if !found {
+				s.cache[h] = append(s.cache[h], pearsonEntry{path: p, f: f})
+			}
+		}
+		if node != nil {
+			child := node.children[seg]
+			if child == nil {
+				child = &trieNode{f: f}
+				if node.children == nil {
+					node.children = map[string]*trieNode{}
+				}
+				node.children[seg] = child
+			}
+			node = child
+		}
+	}
+	return nil
+}
+
+// CompareAndSwap implements CompareAndSwapper.CompareAndSwap(). Like other writes, this must be
+// called before RO() and WithRWLock() must be used if there are concurrent readers. Handles
+// already returned by Open() keep the old content.
+func (s *Simple) CompareAndSwap(name string, old, new []byte) (swapped bool, err error) {
+	clean, err := normalize("cas", name)
+	if err != nil {
+		return false, err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+	if s.closed {
+		return false, &fs.PathError{Op: "cas", Path: name, Err: fs.ErrClosed}
+	}
+	if s.ro {
+		return false, fmt.Errorf("Simple is locked from writing")
+	}
+
+	f, err := s.lookup(clean)
+	if err != nil {
+		return false, &fs.PathError{Op: "cas", Path: name, Err: err}
+	}
+	if f.isDir {
+		return false, &fs.PathError{Op: "cas", Path: name, Err: ErrIsDirectory}
+	}
+	if !bytes.Equal(f.content, old) {
+		return false, nil
+	}
+	if s.copyOnWrite {
+		new = append([]byte{}, new...)
+	}
+	f.content = new
+	f.time = time.Now()
+	return true, nil
+}
+
+// Touch sets the modification time of the file or directory at name to t without changing
+// its content. A zero t means time.Now(). This must be called before RO().
+func (s *Simple) Touch(name string, t time.Time) error {
+	clean, err := normalize("touch", name)
+	if err != nil {
+		return err
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+	if s.closed {
+		return &fs.PathError{Op: "touch", Path: name, Err: fs.ErrClosed}
+	}
+	if s.ro {
+		return fmt.Errorf("Simple is locked from writing")
+	}
+
+	f, err := s.lookup(clean)
+	if err != nil {
+		return &fs.PathError{Op: "touch", Path: name, Err: err}
+	}
+	f.time = t
 	return nil
 }
 
-// RO locks the file system from writing.
+// RO locks the file system from writing. If the Pearson cache can't be built, the error is
+// logged with the log package and lookups fall back to walking the tree. Use ROErr() to handle
+// the error instead.
 func (s *Simple) RO() {
-	s.ro = true
+	if err := s.ROErr(); err != nil {
+		log.Printf("Simple.RO(): %s", err)
+	}
+}
 
+// ROErr locks the file system from writing, like RO(). If the Pearson cache can't be built,
+// the file system is still locked, lookups fall back to walking the tree and the error is returned.
+func (s *Simple) ROErr() error {
+	// The indexes are built from the tree directly, not through Open() or ReadDir(), so the
+	// locks can be held for the whole call without deadlocking.
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+
+	if s.closed {
+		// Close() released the tree, so there is nothing to index and every lookup fails anyway.
+		s.ro = true
+		return nil
+	}
+
+	var err error
 	if s.pearson {
-		sl := make([]*file, s.items)
-
-		fs.WalkDir(
-			s,
-			".",
-			func(path string, d fs.DirEntry, err error) error {
-				if d.IsDir() {
-					return nil
-				}
-				h := pearson([]byte(path))
-				i := int(h) % (len(s.cache) + 1)
-				sl[i] = d.(*file)
-				return nil
-			},
-		)
-		s.cache = sl
+		// pearson() returns a byte, so 256 buckets are always in range no matter how few
+		// files there are, including none.
+		cache := make([][]pearsonEntry, 256)
+		if files := buildPearson(s.root, "", cache); files != s.items {
+			err = fmt.Errorf("could not build Pearson cache: found %d files, but %d were written", files, s.items)
+		} else {
+			s.cache = cache
+		}
+	}
+	if s.useTrie {
+		s.trie = buildTrie(s.root)
+	}
+	s.ro = true
+	return err
+}
+
+// buildPearson adds every file and directory below f, whose path is dir ("" for the root), to
+// cache and returns how many files, not counting directories, it found.
+func buildPearson(f *file, dir string, cache [][]pearsonEntry) int {
+	files := 0
+	for _, o := range f.objects {
+		c := o.(*file)
+		p := path.Join(dir, c.name)
+		h := pearson([]byte(p))
+		cache[h] = append(cache[h], pearsonEntry{path: p, f: c})
+		if c.isDir {
+			files += buildPearson(c, p, cache)
+		} else {
+			files++
+		}
 	}
+	return files
+}
+
+// trieNode is a node in the index built by WithTrie(). It mirrors the tree, but children
+// are found with a map lookup instead of a binary search.
+type trieNode struct {
+	f        *file
+	children map[string]*trieNode
+}
+
+func buildTrie(f *file) *trieNode {
+	n := &trieNode{f: f}
+	if len(f.objects) > 0 {
+		n.children = make(map[string]*trieNode, len(f.objects))
+		for _, o := range f.objects {
+			c := o.(*file)
+			n.children[c.name] = buildTrie(c)
+		}
+	}
+	return n
+}
+
+// find returns the file at name, which must be normalized, or nil if it doesn't exist.
+func (t *trieNode) find(name string) *file {
+	n := t
+	for name != "" {
+		seg := name
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			seg, name = name[:i], name[i+1:]
+		} else {
+			name = ""
+		}
+		n = n.children[seg]
+		if n == nil {
+			return nil
+		}
+	}
+	return n.f
+}
+
+// Close releases the content of all files so the memory can be reclaimed before the Simple
+// itself is garbage collected. This is useful when rotating out a Simple used as a cache. After
+// Close, all operations return an error wrapping fs.ErrClosed. Close is safe to call more than once.
+func (s *Simple) Close() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.rwLock {
+		s.rwMu.Lock()
+		defer s.rwMu.Unlock()
+	}
+
+	s.root.release()
+	s.cache = nil
+	s.trie = nil
+	if s.names != nil {
+		s.names = map[string]string{}
+	}
+	s.items = 0
+	s.closed = true
+	return nil
 }
 
 // WRFile provides an io.WriteCloser implementation.
@@ -296,22 +1076,47 @@ type file struct {
 	offset  int64
 	time    time.Time
 	isDir   bool
+	perm    fs.FileMode // Only used for directories.
+	meta    map[string]string
 
 	objects []fs.DirEntry
+
+	// These are only set on directory handles returned by getCopy(). listing is the snapshot
+	// of dir.objects taken by the first ReadDir() and listOffset is the position in it, which
+	// is kept apart from offset so that Seek() can't move it.
+	owner      *Simple
+	dir        *file
+	listing    []fs.DirEntry
+	listOffset int
 }
 
-func (f *file) getCopy() *file {
+// getCopy returns a handle to f that has its own offsets. For directories the entries are not
+// copied until ReadDir() is called, as most handles are only used for Stat().
+func (f *file) getCopy(owner *Simple) *file {
 	n := *f
+	if f.isDir {
+		n.owner = owner
+		n.dir = f
+	}
 	return &n
 }
 
+// release drops references to the content and children of f and everything below it.
+func (f *file) release() {
+	for _, o := range f.objects {
+		o.(*file).release()
+	}
+	f.objects = nil
+	f.content = nil
+}
+
 // createDir creates a new *file representing a dir inside this file (which must represent a dir).
-func (f *file) createDir(name string) {
+func (f *file) createDir(name string, perm fs.FileMode) {
 	if !f.isDir {
 		panic("bug: createDir() called on file with isDir == false")
 	}
 
-	n := &file{name: name, isDir: true}
+	n := &file{name: name, isDir: true, perm: perm, time: time.Now()}
 	f.objects = append(f.objects, n)
 	sort.Slice(f.objects,
 		func(i, j int) bool {
@@ -343,6 +1148,27 @@ func (f *file) addFile(nf *file) {
 	)
 }
 
+// removeFile removes the sub file named "name", keeping objects sorted.
+func (f *file) removeFile(name string) {
+	for i, o := range f.objects {
+		if o.Name() == name {
+			f.objects = append(f.objects[:i:i], f.objects[i+1:]...)
+			return
+		}
+	}
+}
+
+// height returns how many levels of files are below f.
+func (f *file) height() int {
+	h := 0
+	for _, o := range f.objects {
+		if oh := o.(*file).height() + 1; oh > h {
+			h = oh
+		}
+	}
+	return h
+}
+
 // Search searches for the sub file named "name". This only works if isDir is true.
 func (f *file) Search(name string) (*file, error) {
 	if !f.isDir {
@@ -373,8 +1199,12 @@ func (f *file) IsDir() bool {
 	return f.isDir
 }
 
+// Type implements fs.DirEntry.Type(), which only has the type bits of the mode.
 func (f *file) Type() fs.FileMode {
-	return fileMode
+	if f.isDir {
+		return fs.ModeDir
+	}
+	return 0
 }
 
 func (f *file) Info() (fs.FileInfo, error) {
@@ -388,25 +1218,83 @@ func (f *file) Stat() (fs.FileInfo, error) {
 		size:  int64(len(f.content)),
 		time:  f.time,
 		isDir: f.isDir,
+		perm:  f.perm,
+		meta:  f.meta,
 	}, nil
 }
 
-// Read implements io.Reader.
+// Read implements io.Reader. A Read that consumes the last of the content returns a nil error
+// and the next Read returns 0, io.EOF. Once at the end, io.EOF is returned even if b is empty.
 func (f *file) Read(b []byte) (int, error) {
 	if f.isDir {
-		return 0, fmt.Errorf("cannot Read() a directory")
-	}
-	if len(b) == 0 {
-		return 0, nil
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: ErrIsDirectory}
 	}
 	if int(f.offset) >= len(f.content) {
 		return 0, io.EOF
 	}
+	if len(b) == 0 {
+		return 0, nil
+	}
 	i := copy(b, f.content[f.offset:])
 	f.offset += int64(i)
 	return i, nil
 }
 
+// ReadAt implements io.ReaderAt. It reads directly from the content and neither uses nor
+// changes the offset used by Read() and Seek(), so it can be used from multiple goroutines.
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if f.isDir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: ErrIsDirectory}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(f.content)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.content[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// ReadDir implements fs.ReadDirFile. The entries are a snapshot taken by the first call, so
+// writes after that are not seen.
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+
+	if f.listing == nil {
+		f.listing = f.snapshot()
+	}
+	if f.listOffset > len(f.listing) {
+		f.listOffset = len(f.listing)
+	}
+	remain := f.listing[f.listOffset:]
+	if n > 0 && len(remain) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(remain) {
+		n = len(remain)
+	}
+	entries := append([]fs.DirEntry(nil), remain[:n]...)
+	f.listOffset += n
+	return entries, nil
+}
+
+// snapshot returns a copy of the directory's entries. Writes re-sort objects in place, so this
+// is done under the owner's read lock.
+func (f *file) snapshot() []fs.DirEntry {
+	if f.owner == nil || f.dir == nil {
+		return append([]fs.DirEntry{}, f.objects...)
+	}
+	f.owner.rLock()
+	defer f.owner.rUnlock()
+	return append([]fs.DirEntry{}, f.dir.objects...)
+}
+
 // Seek implement io.Seeker.
 func (f *file) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
@@ -442,6 +1330,8 @@ type fileInfo struct {
 	size  int64
 	time  time.Time
 	isDir bool
+	perm  fs.FileMode
+	meta  map[string]string
 }
 
 func (f fileInfo) Name() string {
@@ -452,6 +1342,9 @@ func (f fileInfo) Size() int64 {
 	return f.size
 }
 func (f fileInfo) Mode() fs.FileMode {
+	if f.isDir {
+		return fs.ModeDir | f.perm
+	}
 	return fileMode
 }
 func (f fileInfo) ModTime() time.Time {
@@ -460,6 +1353,15 @@ func (f fileInfo) ModTime() time.Time {
 func (f fileInfo) IsDir() bool {
 	return f.isDir
 }
+
+// Sys returns a copy of the file's metadata as a map[string]string or nil if there is none.
 func (f fileInfo) Sys() interface{} {
-	return nil
+	if len(f.meta) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(f.meta))
+	for k, v := range f.meta {
+		m[k] = v
+	}
+	return m
 }
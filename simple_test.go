@@ -0,0 +1,1482 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	jsfstest "github.com/johnsiilver/fs/internal/fstest"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestSimpleRWLock(t *testing.T) {
+	simple := NewSimple(WithRWLock())
+	if err := simple.WriteFile("dir/seed.txt", []byte("seed"), 0660); err != nil {
+		t.Fatalf("TestSimpleRWLock(seed write): got err == %s, want err == nil", err)
+	}
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				name := fmt.Sprintf("dir/%d/%d.txt", w, i)
+				if err := simple.WriteFile(name, []byte(name), 0660); err != nil {
+					t.Errorf("TestSimpleRWLock(WriteFile(%s)): got err == %s, want err == nil", name, err)
+				}
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				b, err := simple.ReadFile("dir/seed.txt")
+				if err != nil || string(b) != "seed" {
+					t.Errorf("TestSimpleRWLock(ReadFile): got (%q, %v), want ('seed', nil)", string(b), err)
+				}
+				entries, err := simple.ReadDir("dir")
+				if err != nil {
+					t.Errorf("TestSimpleRWLock(ReadDir): got err == %s, want err == nil", err)
+				}
+				for _, e := range entries {
+					e.Name()
+				}
+				if _, err := simple.Stat("dir"); err != nil {
+					t.Errorf("TestSimpleRWLock(Stat): got err == %s, want err == nil", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	fs.WalkDir(simple, "dir", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if count != 401 {
+		t.Fatalf("TestSimpleRWLock: got %d files, want 401", count)
+	}
+}
+
+func TestSimpleRWLockROClose(t *testing.T) {
+	simple := NewSimple(WithRWLock(), WithPearson(), WithTrie())
+	if err := simple.WriteFile("dir/seed.txt", []byte("seed"), 0660); err != nil {
+		t.Fatalf("TestSimpleRWLockROClose(seed write): got err == %s, want err == nil", err)
+	}
+
+	// Errors are expected once RO() or Close() run, this only checks that there is no race.
+	wg := sync.WaitGroup{}
+	for g := 0; g < 4; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				simple.ReadFile("dir/seed.txt")
+				simple.WriteFile(fmt.Sprintf("dir/%d/%d.txt", g, i), nil, 0660)
+				simple.OpenFile("dir/seed.txt", os.O_WRONLY)
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		simple.RO()
+	}()
+	go func() {
+		defer wg.Done()
+		simple.Close()
+	}()
+	wg.Wait()
+
+	if err := simple.WriteFile("after.txt", nil, 0660); err == nil {
+		t.Errorf("TestSimpleRWLockROClose: WriteFile() after RO() and Close(): got err == nil, want err != nil")
+	}
+}
+
+func TestPearson(t *testing.T) {
+	simple := NewSimple(WithPearson())
+	if !simple.pearson {
+		t.Fatalf("TestPearson: NewSimple(WithPearson()).pearson == false, want true")
+	}
+	names := []string{}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("dir%d/file%d.txt", i%10, i)
+		names = append(names, name)
+		if err := simple.WriteFile(name, []byte(name), 0660); err != nil {
+			t.Fatalf("TestPearson(WriteFile(%s)): got err == %s, want err == nil", name, err)
+		}
+	}
+	if err := simple.ROErr(); err != nil {
+		t.Fatalf("TestPearson(ROErr): got err == %s, want err == nil", err)
+	}
+	if simple.cache == nil {
+		t.Fatalf("TestPearson: cache was not built by ROErr()")
+	}
+
+	for _, name := range names {
+		b, err := simple.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestPearson(ReadFile(%s)): got err == %s, want err == nil", name, err)
+		}
+		if string(b) != name {
+			t.Fatalf("TestPearson(ReadFile(%s)): got %q, want %q", name, string(b), name)
+		}
+	}
+	if _, err := simple.Open("dir3"); err != nil {
+		t.Fatalf("TestPearson(Open(dir3)): got err == %s, want err == nil", err)
+	}
+	if _, err := simple.Open("dir3/nope.txt"); err != fs.ErrNotExist {
+		t.Fatalf("TestPearson(Open(dir3/nope.txt)): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestPearsonSmall(t *testing.T) {
+	tests := []struct {
+		desc  string
+		files map[string][]byte
+	}{
+		{desc: "No files", files: map[string][]byte{}},
+		{desc: "One file", files: map[string][]byte{"a.txt": []byte("a")}},
+		{desc: "One empty file", files: map[string][]byte{"a.txt": nil}},
+		{desc: "Two files", files: map[string][]byte{"a.txt": []byte("a"), "dir/b.txt": []byte("b")}},
+	}
+
+	for _, test := range tests {
+		simple := NewSimple(WithPearson())
+		for name, content := range test.files {
+			if err := simple.WriteFile(name, content, 0660); err != nil {
+				t.Fatalf("TestPearsonSmall(%s): WriteFile(%s): got err == %s, want err == nil", test.desc, name, err)
+			}
+		}
+		simple.RO()
+
+		for name, content := range test.files {
+			b, err := simple.ReadFile(name)
+			if err != nil || string(b) != string(content) {
+				t.Errorf("TestPearsonSmall(%s): ReadFile(%s): got (%q, %v), want (%q, nil)", test.desc, name, string(b), err, string(content))
+			}
+		}
+		for _, name := range []string{"none.txt", "dir/none.txt", "a.txt/none"} {
+			if _, err := simple.Open(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("TestPearsonSmall(%s): Open(%s): got err == %v, want fs.ErrNotExist", test.desc, name, err)
+			}
+		}
+		if fi, err := simple.Stat("."); err != nil || !fi.IsDir() {
+			t.Errorf("TestPearsonSmall(%s): Stat(.): got (%v, %v), want a directory", test.desc, fi, err)
+		}
+	}
+}
+
+func TestSimpleROErr(t *testing.T) {
+	for _, useRO := range []bool{false, true} {
+		simple := NewSimple(WithPearson())
+		simple.WriteFile("a/b.txt", []byte("b"), 0660)
+		simple.WriteFile("c.txt", []byte("c"), 0660)
+		simple.items++ // Simulate a file the cache build can't find.
+
+		if useRO {
+			buf := &bytes.Buffer{}
+			log.SetOutput(buf)
+			simple.RO() // Must not panic.
+			log.SetOutput(os.Stderr)
+			if !strings.Contains(buf.String(), "Pearson cache") {
+				t.Errorf("TestSimpleROErr(RO): got log %q, want the ROErr() error logged", buf.String())
+			}
+		} else if err := simple.ROErr(); err == nil {
+			t.Fatalf("TestSimpleROErr: got err == nil, want err != nil")
+		}
+		if err := simple.WriteFile("d.txt", nil, 0660); err == nil {
+			t.Errorf("TestSimpleROErr(RO %v): WriteFile() after ROErr(): got err == nil, want err != nil", useRO)
+		}
+
+		for _, name := range []string{"a/b.txt", "c.txt"} {
+			b, err := simple.ReadFile(name)
+			if err != nil || string(b) != path.Base(name)[:1] {
+				t.Errorf("TestSimpleROErr(RO %v, %s): got (%q, %v), want (%q, nil)", useRO, name, string(b), err, path.Base(name)[:1])
+			}
+		}
+		if fi, err := simple.Stat("a"); err != nil || !fi.IsDir() {
+			t.Errorf("TestSimpleROErr(RO %v, a): got (%v, %v), want a directory", useRO, fi, err)
+		}
+		if _, err := simple.Open("x.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestSimpleROErr(RO %v, x.txt): got err == %v, want fs.ErrNotExist", useRO, err)
+		}
+	}
+}
+
+func TestSimpleROErrValidation(t *testing.T) {
+	simple := NewSimple(WithPearson())
+	simple.WriteFile("a/b.txt", []byte("b"), 0660)
+	simple.items++ // Simulate a file the cache build can't find.
+
+	if err := simple.ROErr(); err == nil {
+		t.Fatalf("TestSimpleROErrValidation: got err == nil, want err != nil")
+	}
+	if simple.cache != nil {
+		t.Errorf("TestSimpleROErrValidation: cache was kept after failing validation")
+	}
+	if b, err := simple.ReadFile("a/b.txt"); err != nil || string(b) != "b" {
+		t.Errorf("TestSimpleROErrValidation: got (%q, %v), want ('b', nil)", string(b), err)
+	}
+
+	closed := NewSimple(WithPearson())
+	closed.WriteFile("a/b.txt", []byte("b"), 0660)
+	closed.Close()
+	if err := closed.ROErr(); err != nil {
+		t.Errorf("TestSimpleROErrValidation(closed): got err == %s, want err == nil", err)
+	}
+}
+
+func TestSimpleNormalize(t *testing.T) {
+	invalid := []string{
+		"/a/b.txt",
+		"//a/b.txt",
+		"./a/b.txt",
+		"a//b.txt",
+		"a/./b.txt",
+		"a/",
+		"/",
+		"..",
+		"../a/b.txt",
+		"a/../../b.txt",
+	}
+
+	for _, pearson := range []bool{false, true} {
+		var opts []SimpleOption
+		if pearson {
+			opts = append(opts, WithPearson())
+		}
+		simple := NewSimple(opts...)
+		if err := simple.WriteFile("a/b.txt", []byte("b"), 0660); err != nil {
+			t.Fatalf("TestSimpleNormalize(WriteFile): got err == %s, want err == nil", err)
+		}
+		for _, in := range invalid {
+			if strings.HasSuffix(in, "/") {
+				continue // WriteFile() rejects these as directories.
+			}
+			if err := simple.WriteFile(in, []byte("x"), 0660); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSimpleNormalize(pearson %v, WriteFile(%s)): got err == %v, want fs.ErrInvalid", pearson, in, err)
+			}
+		}
+		if pearson {
+			simple.RO()
+		}
+
+		if b, err := simple.ReadFile("a/b.txt"); err != nil || string(b) != "b" {
+			t.Errorf("TestSimpleNormalize(pearson %v, ReadFile(a/b.txt)): got (%q, %v), want ('b', nil)", pearson, string(b), err)
+		}
+		for _, in := range invalid {
+			if _, err := simple.Open(in); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSimpleNormalize(pearson %v, Open(%s)): got err == %v, want fs.ErrInvalid", pearson, in, err)
+			}
+			if _, err := simple.ReadFile(in); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSimpleNormalize(pearson %v, ReadFile(%s)): got err == %v, want fs.ErrInvalid", pearson, in, err)
+			}
+			if _, err := simple.Stat(in); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSimpleNormalize(pearson %v, Stat(%s)): got err == %v, want fs.ErrInvalid", pearson, in, err)
+			}
+			if _, err := simple.ReadDir(in); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("TestSimpleNormalize(pearson %v, ReadDir(%s)): got err == %v, want fs.ErrInvalid", pearson, in, err)
+			}
+		}
+	}
+}
+
+func TestSimpleDotDot(t *testing.T) {
+	simple := NewSimple()
+	if err := simple.WriteFile("a/c", []byte("c"), 0660); err != nil {
+		t.Fatalf("TestSimpleDotDot(WriteFile(a/c)): got err == %s, want err == nil", err)
+	}
+
+	checkInvalid := func(op string, err error) {
+		t.Helper()
+		var pe *fs.PathError
+		if !errors.As(err, &pe) || !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestSimpleDotDot(%s): got err == %v, want *fs.PathError wrapping fs.ErrInvalid", op, err)
+		}
+	}
+
+	// a/b/../c would be a/c if resolved, but ".." is never resolved.
+	_, err := simple.Open("a/b/../c")
+	checkInvalid("Open(a/b/../c)", err)
+	_, err = simple.ReadFile("a/b/../c")
+	checkInvalid("ReadFile(a/b/../c)", err)
+	_, err = simple.ReadDir("a/b/..")
+	checkInvalid("ReadDir(a/b/..)", err)
+	checkInvalid("WriteFile(a/../d)", simple.WriteFile("a/../d", []byte("d"), 0660))
+	_, err = simple.Stat("a/b/../c")
+	checkInvalid("Stat(a/b/../c)", err)
+
+	// Names that only contain dots are not ".." elements.
+	for _, name := range []string{"a..b/..c", "a/...", "a/c..d"} {
+		if err := simple.WriteFile(name, []byte(name), 0660); err != nil {
+			t.Errorf("TestSimpleDotDot(WriteFile(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		b, err := simple.ReadFile(name)
+		if err != nil || string(b) != name {
+			t.Errorf("TestSimpleDotDot(ReadFile(%s)): got (%q, %v), want (%q, nil)", name, string(b), err, name)
+		}
+	}
+}
+
+func TestSimpleClose(t *testing.T) {
+	simple := NewSimple(WithRWLock())
+	if err := simple.WriteFile("a/b.txt", []byte("b"), 0660); err != nil {
+		t.Fatalf("TestSimpleClose(WriteFile): got err == %s, want err == nil", err)
+	}
+	stored := simple.root.objects[0].(*file)
+
+	if err := simple.Close(); err != nil {
+		t.Fatalf("TestSimpleClose(Close): got err == %s, want err == nil", err)
+	}
+	if err := simple.Close(); err != nil {
+		t.Fatalf("TestSimpleClose(second Close): got err == %s, want err == nil", err)
+	}
+
+	if len(simple.root.objects) != 0 || len(stored.objects) != 0 {
+		t.Errorf("TestSimpleClose: tree was not emptied")
+	}
+
+	checks := map[string]error{}
+	_, checks["Open"] = simple.Open("a/b.txt")
+	_, checks["Open(.)"] = simple.Open(".")
+	_, checks["ReadFile"] = simple.ReadFile("a/b.txt")
+	_, checks["ReadDir"] = simple.ReadDir("a")
+	_, checks["Stat"] = simple.Stat("a/b.txt")
+	_, checks["OpenFile"] = simple.OpenFile("a/c.txt", os.O_WRONLY|os.O_CREATE)
+	checks["WriteFile"] = simple.WriteFile("a/c.txt", []byte("c"), 0660)
+
+	for op, err := range checks {
+		if !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("TestSimpleClose(%s): got err == %v, want fs.ErrClosed", op, err)
+		}
+	}
+}
+
+func TestSimpleReadDirectory(t *testing.T) {
+	simple := MapFS(map[string][]byte{"dir/file.txt": []byte("hello")})
+
+	layers := map[string]fs.FS{
+		"Simple":    simple,
+		"WithRetry": WithRetry(simple, RetryPolicy{}),
+	}
+	for desc, fsys := range layers {
+		_, err := fs.ReadFile(fsys, "dir")
+		var pe *fs.PathError
+		if !errors.Is(err, ErrIsDirectory) || !errors.As(err, &pe) || pe.Op != "read" {
+			t.Errorf("TestSimpleReadDirectory(%s ReadFile): got err == %v, want read *fs.PathError wrapping ErrIsDirectory", desc, err)
+		}
+
+		f, err := fsys.Open("dir")
+		if err != nil {
+			t.Errorf("TestSimpleReadDirectory(%s Open): got err == %s, want err == nil", desc, err)
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil || !fi.IsDir() {
+			t.Errorf("TestSimpleReadDirectory(%s Stat): got (%v, %v), want a directory", desc, fi, err)
+		}
+		if _, err := f.Read(make([]byte, 1)); !errors.Is(err, ErrIsDirectory) {
+			t.Errorf("TestSimpleReadDirectory(%s Read): got err == %v, want ErrIsDirectory", desc, err)
+		}
+	}
+}
+
+func TestSimpleSetMeta(t *testing.T) {
+	simple := MapFS(map[string][]byte{"a.txt": []byte("a")}).(*Simple)
+
+	before, err := simple.Open("a.txt")
+	if err != nil {
+		t.Fatalf("TestSimpleSetMeta(Open): got err == %s, want err == nil", err)
+	}
+	if err := simple.SetMeta("a.txt", "content-type", "text/plain"); err != nil {
+		t.Fatalf("TestSimpleSetMeta(SetMeta): got err == %s, want err == nil", err)
+	}
+
+	fi, _ := simple.Stat("a.txt")
+	if got := fi.Sys().(map[string]string)["content-type"]; got != "text/plain" {
+		t.Errorf("TestSimpleSetMeta: got content-type %q, want 'text/plain'", got)
+	}
+	fi, _ = before.Stat()
+	if fi.Sys() != nil {
+		t.Errorf("TestSimpleSetMeta: file opened before SetMeta() saw the change")
+	}
+
+	if err := simple.SetMeta("nope.txt", "k", "v"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestSimpleSetMeta(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+	simple.RO()
+	if err := simple.SetMeta("a.txt", "k", "v"); err == nil {
+		t.Errorf("TestSimpleSetMeta(after RO): got err == nil, want err != nil")
+	}
+}
+
+// internTree writes a tree where most path segments repeat across files.
+func internTree(opts ...SimpleOption) *Simple {
+	simple := NewSimple(opts...)
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 20; j++ {
+			name := fmt.Sprintf("vendor/github.com/org%d/project/internal/pkg/file%d.go", i, j)
+			if err := simple.WriteFile(name, nil, 0660); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return simple
+}
+
+func TestSimpleStringInterning(t *testing.T) {
+	plain := internTree()
+	interned := internTree(WithStringInterning())
+
+	var want, got []string
+	fs.WalkDir(plain, ".", func(p string, d fs.DirEntry, err error) error {
+		want = append(want, p)
+		return nil
+	})
+	fs.WalkDir(interned, ".", func(p string, d fs.DirEntry, err error) error {
+		got = append(got, p)
+		return nil
+	})
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Fatalf("TestSimpleStringInterning: -want/+got:\n%s", diff)
+	}
+	// 100 org names, 20 file names and 5 shared directory names.
+	if len(interned.names) != 125 {
+		t.Fatalf("TestSimpleStringInterning: interning table has %d names, want 125", len(interned.names))
+	}
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+func BenchmarkSimpleStringInterning(b *testing.B) {
+	tests := []struct {
+		desc string
+		opts []SimpleOption
+	}{
+		{desc: "Default"},
+		{desc: "WithStringInterning", opts: []SimpleOption{WithStringInterning()}},
+	}
+
+	for _, test := range tests {
+		b.Run(test.desc, func(b *testing.B) {
+			var total uint64
+			for i := 0; i < b.N; i++ {
+				before := heapAlloc()
+				simple := internTree(test.opts...)
+				total += heapAlloc() - before
+				runtime.KeepAlive(simple)
+			}
+			b.ReportMetric(float64(total)/float64(b.N), "heap-bytes/tree")
+		})
+	}
+}
+
+func TestSimpleReadEOF(t *testing.T) {
+	simple := NewSimple()
+	simple.WriteFile("file.txt", []byte("hello"), 0660)
+	f, err := simple.Open("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		desc    string
+		bufSize int
+		wantN   int
+		wantErr error
+	}{
+		{desc: "Zero length before the end", bufSize: 0, wantN: 0},
+		{desc: "Read to the exact end", bufSize: 5, wantN: 5},
+		{desc: "Read after the end", bufSize: 5, wantN: 0, wantErr: io.EOF},
+		{desc: "Zero length at the end", bufSize: 0, wantN: 0, wantErr: io.EOF},
+	}
+
+	for _, step := range steps {
+		n, err := f.Read(make([]byte, step.bufSize))
+		if n != step.wantN || err != step.wantErr {
+			t.Errorf("TestSimpleReadEOF(%s): got (%d, %v), want (%d, %v)", step.desc, n, err, step.wantN, step.wantErr)
+		}
+	}
+
+	// An empty file is at the end from the start.
+	simple.WriteFile("empty.txt", nil, 0660)
+	f, _ = simple.Open("empty.txt")
+	if n, err := f.Read(make([]byte, 5)); n != 0 || err != io.EOF {
+		t.Errorf("TestSimpleReadEOF(empty file): got (%d, %v), want (0, io.EOF)", n, err)
+	}
+}
+
+func TestSimpleEmptyFile(t *testing.T) {
+	for _, content := range [][]byte{nil, {}} {
+		simple := NewSimple()
+		if err := simple.WriteFile("empty.txt", content, 0660); err != nil {
+			t.Fatalf("TestSimpleEmptyFile(%#v): got err == %s, want err == nil", content, err)
+		}
+
+		b, err := simple.ReadFile("empty.txt")
+		if err != nil || b == nil || len(b) != 0 {
+			t.Errorf("TestSimpleEmptyFile(%#v): ReadFile(): got (%#v, %v), want ([]byte{}, nil)", content, b, err)
+		}
+		fi, err := simple.Stat("empty.txt")
+		if err != nil || fi.Size() != 0 || fi.IsDir() {
+			t.Errorf("TestSimpleEmptyFile(%#v): Stat(): got (%v, %v), want a file of size 0", content, fi, err)
+		}
+		if err := simple.WriteFile("empty.txt", nil, 0660); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("TestSimpleEmptyFile(%#v): second WriteFile(): got err == %v, want fs.ErrExist", content, err)
+		}
+	}
+}
+
+func TestSimpleOpenIndependentOffsets(t *testing.T) {
+	simple := NewSimple()
+	simple.WriteFile("file.txt", []byte("abcdef"), 0660)
+
+	f1, _ := simple.Open("file.txt")
+	f2, _ := simple.Open("file.txt")
+
+	var got1, got2 []byte
+	b := make([]byte, 2)
+	for i := 0; i < 3; i++ {
+		n, _ := f1.Read(b)
+		got1 = append(got1, b[:n]...)
+		n, _ = f2.Read(b)
+		got2 = append(got2, b[:n]...)
+	}
+	if string(got1) != "abcdef" || string(got2) != "abcdef" {
+		t.Errorf("TestSimpleOpenIndependentOffsets(interleaved reads): got (%q, %q), want ('abcdef', 'abcdef')", got1, got2)
+	}
+
+	// A new Open after the others reached the end starts at the beginning.
+	f3, _ := simple.Open("file.txt")
+	f1.(io.Seeker).Seek(0, io.SeekStart)
+	n, err := f3.Read(b)
+	if err != nil || string(b[:n]) != "ab" {
+		t.Errorf("TestSimpleOpenIndependentOffsets(new Open): got (%q, %v), want ('ab', nil)", b[:n], err)
+	}
+	if _, err := f2.Read(b); err != io.EOF {
+		t.Errorf("TestSimpleOpenIndependentOffsets(Seek on another handle): got err == %v, want io.EOF", err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, _ := simple.Open("file.txt")
+			b, err := io.ReadAll(f)
+			if err != nil || string(b) != "abcdef" {
+				t.Errorf("TestSimpleOpenIndependentOffsets(concurrent): got (%q, %v), want ('abcdef', nil)", b, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSimpleReadAt(t *testing.T) {
+	simple := MapFS(map[string][]byte{"file.txt": []byte("hello world")})
+	f, err := simple.Open("file.txt")
+	if err != nil {
+		t.Fatalf("TestSimpleReadAt(Open): got err == %s, want err == nil", err)
+	}
+	ra := f.(io.ReaderAt)
+
+	// Move the Read() offset to make sure ReadAt() ignores it.
+	if _, err := f.Read(make([]byte, 3)); err != nil {
+		t.Fatalf("TestSimpleReadAt(Read): got err == %s, want err == nil", err)
+	}
+
+	tests := []struct {
+		desc    string
+		off     int64
+		size    int
+		want    string
+		wantErr error
+	}{
+		{desc: "Start", off: 0, size: 5, want: "hello"},
+		{desc: "Middle", off: 6, size: 3, want: "wor"},
+		{desc: "Exact end", off: 6, size: 5, want: "world"},
+		{desc: "Past end of content", off: 6, size: 10, want: "world", wantErr: io.EOF},
+		{desc: "At EOF", off: 11, size: 1, wantErr: io.EOF},
+		{desc: "Past EOF", off: 100, size: 1, wantErr: io.EOF},
+	}
+	for _, test := range tests {
+		b := make([]byte, test.size)
+		n, err := ra.ReadAt(b, test.off)
+		if err != test.wantErr {
+			t.Errorf("TestSimpleReadAt(%s): got err == %v, want err == %v", test.desc, err, test.wantErr)
+		}
+		if got := string(b[:n]); got != test.want {
+			t.Errorf("TestSimpleReadAt(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	if _, err := ra.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("TestSimpleReadAt(negative offset): got err == nil, want err != nil")
+	}
+
+	rest, err := io.ReadAll(f)
+	if err != nil || string(rest) != "lo world" {
+		t.Errorf("TestSimpleReadAt: Read() after ReadAt() got (%q, %v), want ('lo world', nil)", string(rest), err)
+	}
+
+	sr := io.NewSectionReader(ra, 2, 7)
+	b, err := io.ReadAll(sr)
+	if err != nil || string(b) != "llo wor" {
+		t.Errorf("TestSimpleReadAt(SectionReader): got (%q, %v), want ('llo wor', nil)", string(b), err)
+	}
+}
+
+func TestSimpleWalk(t *testing.T) {
+	simple := MapFS(map[string][]byte{
+		"a/b/c.txt":    nil,
+		"a/b/d.txt":    nil,
+		"a/skip/e.txt": nil,
+		"f.txt":        nil,
+	}).(*Simple)
+
+	type visit struct {
+		Path  string
+		Depth int
+		IsDir bool
+	}
+	var got []visit
+	err := simple.Walk(".", func(e WalkEntry) error {
+		got = append(got, visit{e.FullPath, e.Depth, e.IsDir})
+		fi, err := e.Info()
+		if err != nil || fi.IsDir() != e.IsDir {
+			t.Errorf("TestSimpleWalk(%s): Info() got (%v, %v), want IsDir() == %v", e.FullPath, fi, err, e.IsDir)
+		}
+		if e.FullPath == "a/skip" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestSimpleWalk: got err == %s, want err == nil", err)
+	}
+
+	want := []visit{
+		{".", 0, true},
+		{"a", 1, true},
+		{"a/b", 2, true},
+		{"a/b/c.txt", 3, false},
+		{"a/b/d.txt", 3, false},
+		{"a/skip", 2, true},
+		{"f.txt", 1, false},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Fatalf("TestSimpleWalk: -want/+got:\n%s", diff)
+	}
+
+	got = nil
+	simple.Walk("a/b", func(e WalkEntry) error {
+		got = append(got, visit{e.FullPath, e.Depth, e.IsDir})
+		if e.FullPath == "a/b/c.txt" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	want = []visit{{"a/b", 0, true}, {"a/b/c.txt", 1, false}}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Fatalf("TestSimpleWalk(SkipDir on a file): -want/+got:\n%s", diff)
+	}
+
+	if err := simple.Walk("nope", func(WalkEntry) error { return nil }); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("TestSimpleWalk(missing root): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestSimpleGlob(t *testing.T) {
+	files := map[string][]byte{
+		"assets/js/app.js":    nil,
+		"assets/js/vendor.js": nil,
+		"assets/js/app.css":   nil,
+		"assets/css/app.css":  nil,
+		"assets/css/x/y.css":  nil,
+		"other/js/app.js":     nil,
+		"top.js":              nil,
+	}
+	patterns := []string{
+		"assets/js/*",
+		"assets/js/*.js",
+		"assets/*/app.css",
+		"*/js/app.js",
+		"*.js",
+		"assets/**",
+		"assets/js/app.js",
+		"assets/nope/*",
+		"assets/js/app.js/*",
+		"a?sets/[cj]s/*.css",
+		"assets/../*",
+		"assets/js/../*.js",
+		"../*",
+	}
+
+	for _, pearson := range []bool{false, true} {
+		var opts []SimpleOption
+		if pearson {
+			opts = append(opts, WithPearson())
+		}
+		simple := NewSimple(opts...)
+		for name, content := range files {
+			simple.WriteFile(name, content, 0660)
+		}
+		if pearson {
+			simple.RO()
+		}
+
+		for _, pattern := range patterns {
+			got, err := simple.Glob(pattern)
+			if err != nil {
+				t.Errorf("TestSimpleGlob(pearson %v, %s): got err == %s, want err == nil", pearson, pattern, err)
+				continue
+			}
+			// Hide Simple.Glob() so fs.Glob() uses its generic implementation.
+			want, _ := fs.Glob(struct{ fs.ReadDirFS }{simple}, pattern)
+			if diff := pretty.Compare(want, got); diff != "" {
+				t.Errorf("TestSimpleGlob(pearson %v, %s): -want/+got:\n%s", pearson, pattern, diff)
+			}
+		}
+	}
+
+	if _, err := NewSimple().Glob("[a"); err != path.ErrBadPattern {
+		t.Errorf("TestSimpleGlob(bad pattern): got err == %v, want path.ErrBadPattern", err)
+	}
+
+	closed := NewSimple()
+	closed.WriteFile("top.js", nil, 0660)
+	closed.Close()
+	if _, err := closed.Glob("*.js"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("TestSimpleGlob(closed): got err == %v, want fs.ErrClosed", err)
+	}
+}
+
+func globTree() *Simple {
+	simple := NewSimple(WithPearson())
+	for i := 0; i < 500; i++ {
+		for j := 0; j < 40; j++ {
+			simple.WriteFile(fmt.Sprintf("dir%d/js/file%d.js", i, j), nil, 0660)
+		}
+	}
+	simple.RO()
+	return simple
+}
+
+func BenchmarkSimpleGlob(b *testing.B) {
+	simple := globTree()
+	const pattern = "dir250/js/*.js"
+
+	b.Run("Prefix resolved", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if m, _ := simple.Glob(pattern); len(m) != 40 {
+				b.Fatalf("got %d matches, want 40", len(m))
+			}
+		}
+	})
+
+	b.Run("Full tree scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var m []string
+			fs.WalkDir(simple, ".", func(p string, d fs.DirEntry, err error) error {
+				if ok, _ := path.Match(pattern, p); ok {
+					m = append(m, p)
+				}
+				return nil
+			})
+			if len(m) != 40 {
+				b.Fatalf("got %d matches, want 40", len(m))
+			}
+		}
+	})
+}
+
+func TestSimpleCopyOnWrite(t *testing.T) {
+	tests := []struct {
+		desc string
+		opts []SimpleOption
+		want string
+	}{
+		{desc: "Default stores the reference", want: "Xello"},
+		{desc: "WithCopyOnWrite stores a copy", opts: []SimpleOption{WithCopyOnWrite()}, want: "hello"},
+	}
+
+	for _, test := range tests {
+		simple := NewSimple(test.opts...)
+		buf := []byte("hello")
+		if err := simple.WriteFile("file.txt", buf, 0660); err != nil {
+			t.Fatalf("TestSimpleCopyOnWrite(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		buf[0] = 'X'
+
+		b, err := simple.ReadFile("file.txt")
+		if err != nil || string(b) != test.want {
+			t.Errorf("TestSimpleCopyOnWrite(%s): got (%q, %v), want (%q, nil)", test.desc, string(b), err, test.want)
+		}
+	}
+}
+
+func TestSimpleTrie(t *testing.T) {
+	simple := NewSimple(WithTrie())
+	names := []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "f.txt"}
+	for _, name := range names {
+		simple.WriteFile(name, []byte(name), 0660)
+	}
+	simple.RO()
+	if simple.trie == nil {
+		t.Fatalf("TestSimpleTrie: trie was not built by RO()")
+	}
+
+	for _, name := range names {
+		b, err := simple.ReadFile(name)
+		if err != nil || string(b) != name {
+			t.Errorf("TestSimpleTrie(ReadFile(%s)): got (%q, %v), want (%q, nil)", name, string(b), err, name)
+		}
+	}
+	for _, dir := range []string{"a", "a/b"} {
+		fi, err := simple.Stat(dir)
+		if err != nil || !fi.IsDir() {
+			t.Errorf("TestSimpleTrie(Stat(%s)): got (%v, %v), want a directory", dir, fi, err)
+		}
+	}
+	for _, name := range []string{"a/b/x.txt", "a/b/c.txt/d", "x"} {
+		if _, err := simple.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestSimpleTrie(Open(%s)): got err == %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	got, _ := simple.Glob("a/b/*")
+	if diff := pretty.Compare([]string{"a/b/c.txt", "a/b/d.txt"}, got); diff != "" {
+		t.Errorf("TestSimpleTrie(Glob): -want/+got:\n%s", diff)
+	}
+}
+
+func TestSimpleFallback(t *testing.T) {
+	fallback := fstest.MapFS{
+		"base.txt":   &fstest.MapFile{Data: []byte("base")},
+		"shared.txt": &fstest.MapFile{Data: []byte("fallback")},
+	}
+	simple := NewSimple(WithFallback(fallback))
+	simple.WriteFile("shared.txt", []byte("memory"), 0660)
+	simple.WriteFile("memory.txt", []byte("memory"), 0660)
+
+	tests := []struct {
+		desc    string
+		name    string
+		want    string
+		wantErr error
+	}{
+		{desc: "Hit in memory", name: "memory.txt", want: "memory"},
+		{desc: "Memory shadows fallback", name: "shared.txt", want: "memory"},
+		{desc: "Miss falls back", name: "base.txt", want: "base"},
+		{desc: "Invalid name does not fall back", name: "/base.txt", wantErr: fs.ErrInvalid},
+		{desc: "Miss in both", name: "none.txt", wantErr: fs.ErrNotExist},
+	}
+
+	for _, test := range tests {
+		b, err := simple.ReadFile(test.name)
+		switch {
+		case test.wantErr != nil:
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("TestSimpleFallback(%s): ReadFile(): got err == %v, want %v", test.desc, err, test.wantErr)
+			}
+			if _, err := simple.Open(test.name); !errors.Is(err, test.wantErr) {
+				t.Errorf("TestSimpleFallback(%s): Open(): got err == %v, want %v", test.desc, err, test.wantErr)
+			}
+			if _, err := simple.Stat(test.name); !errors.Is(err, test.wantErr) {
+				t.Errorf("TestSimpleFallback(%s): Stat(): got err == %v, want %v", test.desc, err, test.wantErr)
+			}
+			continue
+		case err != nil:
+			t.Errorf("TestSimpleFallback(%s): ReadFile(): got err == %s, want err == nil", test.desc, err)
+			continue
+		case string(b) != test.want:
+			t.Errorf("TestSimpleFallback(%s): ReadFile(): got %q, want %q", test.desc, string(b), test.want)
+		}
+
+		f, err := simple.Open(test.name)
+		if err != nil {
+			t.Errorf("TestSimpleFallback(%s): Open(): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		b, err = io.ReadAll(f)
+		f.Close()
+		if err != nil || string(b) != test.want {
+			t.Errorf("TestSimpleFallback(%s): Open().Read(): got (%q, %v), want (%q, nil)", test.desc, string(b), err, test.want)
+		}
+
+		fi, err := simple.Stat(test.name)
+		if err != nil || fi.Size() != int64(len(test.want)) {
+			t.Errorf("TestSimpleFallback(%s): Stat(): got (%v, %v), want size %d", test.desc, fi, err, len(test.want))
+		}
+	}
+}
+
+func TestSimpleDirMode(t *testing.T) {
+	tests := []struct {
+		desc string
+		opts []SimpleOption
+		want fs.FileMode
+	}{
+		{desc: "Default", want: fs.ModeDir | 0555},
+		{desc: "WithDirMode", opts: []SimpleOption{WithDirMode(0750)}, want: fs.ModeDir | 0750},
+	}
+
+	for _, test := range tests {
+		simple := NewSimple(test.opts...)
+		if err := simple.WriteFile("a/b/c.txt", []byte("c"), 0660); err != nil {
+			t.Fatalf("TestSimpleDirMode(%s): got err == %s, want err == nil", test.desc, err)
+		}
+
+		for _, dir := range []string{".", "a", "a/b"} {
+			fi, err := simple.Stat(dir)
+			if err != nil {
+				t.Fatalf("TestSimpleDirMode(%s): Stat(%s): got err == %s, want err == nil", test.desc, dir, err)
+			}
+			if fi.Mode() != test.want {
+				t.Errorf("TestSimpleDirMode(%s): Stat(%s).Mode(): got %v, want %v", test.desc, dir, fi.Mode(), test.want)
+			}
+			if dir != "." && fi.ModTime().IsZero() {
+				t.Errorf("TestSimpleDirMode(%s): Stat(%s).ModTime(): got zero time", test.desc, dir)
+			}
+		}
+		fi, _ := simple.Stat("a/b/c.txt")
+		if fi.Mode() != fileMode {
+			t.Errorf("TestSimpleDirMode(%s): Stat(a/b/c.txt).Mode(): got %v, want %v", test.desc, fi.Mode(), fileMode)
+		}
+	}
+}
+
+func TestSimpleReadDirSnapshot(t *testing.T) {
+	simple := NewSimple(WithRWLock())
+	for _, name := range []string{"dir/b.txt", "dir/d.txt"} {
+		simple.WriteFile(name, nil, 0660)
+	}
+
+	entries, err := simple.ReadDir("dir")
+	if err != nil {
+		t.Fatalf("TestSimpleReadDirSnapshot: got err == %s, want err == nil", err)
+	}
+	entries[0], entries[1] = entries[1], entries[0]
+	if _, err := simple.Stat("dir/b.txt"); err != nil {
+		t.Fatalf("TestSimpleReadDirSnapshot: changing ReadDir() result broke lookups: %s", err)
+	}
+
+	f, err := simple.Open("dir")
+	if err != nil {
+		t.Fatalf("TestSimpleReadDirSnapshot: Open(dir): got err == %s, want err == nil", err)
+	}
+	batch, err := f.(fs.ReadDirFile).ReadDir(1)
+	if err != nil {
+		t.Fatalf("TestSimpleReadDirSnapshot: ReadDir(1): got err == %s, want err == nil", err)
+	}
+	got := []string{batch[0].Name()}
+	simple.WriteFile("dir/a.txt", nil, 0660)
+
+	for {
+		batch, err := f.(fs.ReadDirFile).ReadDir(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("TestSimpleReadDirSnapshot: ReadDir(1): got err == %s, want err == nil", err)
+		}
+		for _, e := range batch {
+			got = append(got, e.Name())
+		}
+	}
+	if diff := pretty.Compare([]string{"b.txt", "d.txt"}, got); diff != "" {
+		t.Errorf("TestSimpleReadDirSnapshot(directory handle): -want/+got:\n%s", diff)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			simple.WriteFile(fmt.Sprintf("dir/%03d.txt", 500-i), nil, 0660)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			entries, err := simple.ReadDir("dir")
+			if err != nil {
+				t.Errorf("TestSimpleReadDirSnapshot: concurrent ReadDir(): got err == %s, want err == nil", err)
+				return
+			}
+			for j := 1; j < len(entries); j++ {
+				if entries[j-1].Name() >= entries[j].Name() {
+					t.Errorf("TestSimpleReadDirSnapshot: concurrent ReadDir() returned unsorted entries")
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSimpleReadDirAfterSeek(t *testing.T) {
+	simple := NewSimple()
+	for _, name := range []string{"dir/a.txt", "dir/b.txt"} {
+		simple.WriteFile(name, nil, 0660)
+	}
+
+	f, err := simple.Open("dir")
+	if err != nil {
+		t.Fatalf("TestSimpleReadDirAfterSeek: Open(dir): got err == %s, want err == nil", err)
+	}
+	if _, err := f.(io.Seeker).Seek(10, io.SeekStart); err != nil {
+		t.Fatalf("TestSimpleReadDirAfterSeek: Seek(10): got err == %s, want err == nil", err)
+	}
+	entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+	if err != nil {
+		t.Fatalf("TestSimpleReadDirAfterSeek: ReadDir(-1): got err == %s, want err == nil", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("TestSimpleReadDirAfterSeek: got %d entries, want 2", len(entries))
+	}
+}
+
+func TestSimpleWriteFileIfAbsent(t *testing.T) {
+	simple := NewSimple()
+
+	tests := []struct {
+		desc        string
+		name        string
+		data        string
+		wantCreated bool
+		wantErr     bool
+	}{
+		{desc: "File is absent", name: "dir/file.txt", data: "first", wantCreated: true},
+		{desc: "File is present", name: "dir/file.txt", data: "second", wantCreated: false},
+		{desc: "Directory is present", name: "dir", wantErr: true},
+	}
+
+	for _, test := range tests {
+		created, err := simple.WriteFileIfAbsent(test.name, []byte(test.data), 0660)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestSimpleWriteFileIfAbsent(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestSimpleWriteFileIfAbsent(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if created != test.wantCreated {
+			t.Errorf("TestSimpleWriteFileIfAbsent(%s): got created == %v, want %v", test.desc, created, test.wantCreated)
+		}
+	}
+
+	b, err := simple.ReadFile("dir/file.txt")
+	if err != nil || string(b) != "first" {
+		t.Errorf("TestSimpleWriteFileIfAbsent: got content (%q, %v), want ('first', nil)", string(b), err)
+	}
+}
+
+func TestSimpleTouch(t *testing.T) {
+	simple := NewSimple()
+	simple.WriteFile("dir/file.txt", []byte("hello"), 0660)
+
+	want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"dir/file.txt", "dir"} {
+		if err := simple.Touch(name, want); err != nil {
+			t.Fatalf("TestSimpleTouch(%s): got err == %s, want err == nil", name, err)
+		}
+		fi, err := simple.Stat(name)
+		if err != nil || !fi.ModTime().Equal(want) {
+			t.Errorf("TestSimpleTouch(%s): got ModTime (%v, %v), want (%v, nil)", name, fi.ModTime(), err, want)
+		}
+	}
+	if b, _ := simple.ReadFile("dir/file.txt"); string(b) != "hello" {
+		t.Errorf("TestSimpleTouch: Touch() changed content to %q", string(b))
+	}
+
+	before := time.Now()
+	if err := simple.Touch("dir/file.txt", time.Time{}); err != nil {
+		t.Fatalf("TestSimpleTouch(zero time): got err == %s, want err == nil", err)
+	}
+	if fi, _ := simple.Stat("dir/file.txt"); fi.ModTime().Before(before) {
+		t.Errorf("TestSimpleTouch(zero time): got ModTime %v, want >= %v", fi.ModTime(), before)
+	}
+
+	if err := simple.Touch("none.txt", want); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestSimpleTouch(none.txt): got err == %v, want fs.ErrNotExist", err)
+	}
+	simple.RO()
+	if err := simple.Touch("dir/file.txt", want); err == nil {
+		t.Errorf("TestSimpleTouch(after RO): got err == nil, want err != nil")
+	}
+}
+
+func TestSimplePatch(t *testing.T) {
+	tests := []struct {
+		desc string
+		opts []SimpleOption
+	}{
+		{desc: "Tree walk"},
+		{desc: "Pearson", opts: []SimpleOption{WithPearson()}},
+		{desc: "Trie", opts: []SimpleOption{WithTrie()}},
+		{desc: "Pearson and trie with RWLock", opts: []SimpleOption{WithPearson(), WithTrie(), WithRWLock()}},
+	}
+
+	old := []string{"a/b.txt", "a/c/d.txt", "e.txt"}
+	patched := []string{"a/late.txt", "x/y/late.txt"}
+
+	for _, test := range tests {
+		simple := NewSimple(test.opts...)
+		for _, name := range old {
+			simple.WriteFile(name, []byte(name), 0660)
+		}
+		simple.RO()
+
+		for _, name := range patched {
+			if err := simple.Patch(name, []byte(name)); err != nil {
+				t.Fatalf("TestSimplePatch(%s): Patch(%s): got err == %s, want err == nil", test.desc, name, err)
+			}
+		}
+		if err := simple.Patch("a/b.txt", nil); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("TestSimplePatch(%s): Patch(a/b.txt): got err == %v, want fs.ErrExist", test.desc, err)
+		}
+		if err := simple.WriteFile("f.txt", nil, 0660); err == nil {
+			t.Errorf("TestSimplePatch(%s): WriteFile() after RO(): got err == nil, want err != nil", test.desc)
+		}
+
+		for _, name := range append(append([]string{}, old...), patched...) {
+			b, err := simple.ReadFile(name)
+			if err != nil || string(b) != name {
+				t.Errorf("TestSimplePatch(%s): ReadFile(%s): got (%q, %v), want (%q, nil)", test.desc, name, string(b), err, name)
+			}
+		}
+		for _, dir := range []string{"a", "x", "x/y"} {
+			fi, err := simple.Stat(dir)
+			if err != nil || !fi.IsDir() {
+				t.Errorf("TestSimplePatch(%s): Stat(%s): got (%v, %v), want a directory", test.desc, dir, fi, err)
+			}
+		}
+		if _, err := simple.Open("x/none.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestSimplePatch(%s): Open(x/none.txt): got err == %v, want fs.ErrNotExist", test.desc, err)
+		}
+	}
+}
+
+func TestSimpleMaxDepth(t *testing.T) {
+	tests := []struct {
+		desc    string
+		opts    []SimpleOption
+		name    string
+		wantErr error
+	}{
+		{desc: "Unlimited by default", name: "a/b/c/d/e/f/g.txt"},
+		{desc: "At the limit", opts: []SimpleOption{WithMaxDepth(3)}, name: "a/b/c.txt"},
+		{desc: "Over the limit", opts: []SimpleOption{WithMaxDepth(3)}, name: "a/b/c/d.txt", wantErr: ErrTooDeep},
+	}
+
+	for _, test := range tests {
+		simple := NewSimple(test.opts...)
+		err := simple.WriteFile(test.name, nil, 0660)
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("TestSimpleMaxDepth(%s): got err == %s, want err == nil", test.desc, err)
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("TestSimpleMaxDepth(%s): got err == %v, want %v", test.desc, err, test.wantErr)
+		}
+		if test.wantErr != nil {
+			if _, err := simple.Stat("a"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("TestSimpleMaxDepth(%s): directories were created for a rejected path", test.desc)
+			}
+		}
+	}
+
+	src := fstest.MapFS{"a/b/c/d.txt": &fstest.MapFile{}}
+	if err := Merge(NewSimple(WithMaxDepth(3)), src, ""); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("TestSimpleMaxDepth(Merge): got err == %v, want ErrTooDeep", err)
+	}
+}
+
+func TestSimpleCompareAndSwap(t *testing.T) {
+	simple := NewSimple(WithRWLock())
+	simple.WriteFile("file.txt", []byte("v1"), 0660)
+
+	tests := []struct {
+		desc        string
+		name        string
+		old, new    string
+		wantSwapped bool
+		wantErr     bool
+		wantContent string
+	}{
+		{desc: "Match", name: "file.txt", old: "v1", new: "v2", wantSwapped: true, wantContent: "v2"},
+		{desc: "Mismatch", name: "file.txt", old: "v1", new: "v3", wantContent: "v2"},
+		{desc: "Missing file", name: "none.txt", wantErr: true},
+	}
+
+	for _, test := range tests {
+		swapped, err := simple.CompareAndSwap(test.name, []byte(test.old), []byte(test.new))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestSimpleCompareAndSwap(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestSimpleCompareAndSwap(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if swapped != test.wantSwapped {
+			t.Errorf("TestSimpleCompareAndSwap(%s): got swapped == %v, want %v", test.desc, swapped, test.wantSwapped)
+		}
+		if b, _ := simple.ReadFile(test.name); string(b) != test.wantContent {
+			t.Errorf("TestSimpleCompareAndSwap(%s): got content %q, want %q", test.desc, string(b), test.wantContent)
+		}
+	}
+
+	// Each goroutine increments a counter stored in the file until its swap wins.
+	simple.WriteFile("counter", []byte("0"), 0660)
+	const workers = 20
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				cur, err := simple.ReadFile("counter")
+				if err != nil {
+					t.Errorf("TestSimpleCompareAndSwap(contention): ReadFile(): got err == %s, want err == nil", err)
+					return
+				}
+				var n int
+				fmt.Sscan(string(cur), &n)
+				swapped, err := simple.CompareAndSwap("counter", cur, []byte(fmt.Sprint(n+1)))
+				if err != nil {
+					t.Errorf("TestSimpleCompareAndSwap(contention): got err == %s, want err == nil", err)
+					return
+				}
+				if swapped {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if b, _ := simple.ReadFile("counter"); string(b) != fmt.Sprint(workers) {
+		t.Errorf("TestSimpleCompareAndSwap(contention): got counter %q, want %q", string(b), fmt.Sprint(workers))
+	}
+}
+
+var conformFiles = map[string][]byte{
+	"a.txt":         []byte("a"),
+	"empty.txt":     nil,
+	"dir/b.txt":     []byte("b"),
+	"dir/sub/c.txt": []byte("c"),
+	"dir/sub/d.txt": []byte("d"),
+	"other/e f.txt": []byte("e f"),
+	"other/日本.txt":  []byte("日本"),
+}
+
+func TestSimpleRename(t *testing.T) {
+	build := func() *Simple {
+		simple := NewSimple()
+		for _, name := range []string{"a/b.txt", "a/c/d.txt", "a/c/e.txt", "f.txt", "z/y.txt"} {
+			simple.WriteFile(name, []byte(name), 0660)
+		}
+		return simple
+	}
+	paths := func(simple *Simple) []string {
+		var got []string
+		fs.WalkDir(simple, ".", func(p string, d fs.DirEntry, err error) error {
+			got = append(got, p)
+			return err
+		})
+		return got
+	}
+	unchanged := paths(build())
+
+	tests := []struct {
+		desc      string
+		old, new  string
+		wantErr   bool
+		wantFiles map[string]string // name -> content
+		wantGone  []string
+	}{
+		{
+			desc:      "File to a new directory",
+			old:       "f.txt",
+			new:       "new/dir/g.txt",
+			wantFiles: map[string]string{"new/dir/g.txt": "f.txt"},
+			wantGone:  []string{"f.txt"},
+		},
+		{
+			desc:      "File within a directory",
+			old:       "a/b.txt",
+			new:       "a/0.txt",
+			wantFiles: map[string]string{"a/0.txt": "a/b.txt"},
+			wantGone:  []string{"a/b.txt"},
+		},
+		{
+			desc:      "Directory with children",
+			old:       "a/c",
+			new:       "x/c2",
+			wantFiles: map[string]string{"x/c2/d.txt": "a/c/d.txt", "x/c2/e.txt": "a/c/e.txt"},
+			wantGone:  []string{"a/c", "a/c/d.txt"},
+		},
+		{desc: "Source does not exist", old: "none.txt", new: "g.txt", wantErr: true},
+		{desc: "Destination exists", old: "f.txt", new: "a/b.txt", wantErr: true},
+		{desc: "Destination is a directory", old: "f.txt", new: "a", wantErr: true},
+		{desc: "Destination is under a file", old: "a/b.txt", new: "f.txt/new/g.txt", wantErr: true},
+		{desc: "Into itself", old: "a", new: "a/c/a", wantErr: true},
+		{desc: "Root", old: "/", new: "g", wantErr: true},
+	}
+
+	for _, test := range tests {
+		simple := build()
+		err := simple.Rename(test.old, test.new)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestSimpleRename(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestSimpleRename(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			if simple.items != 5 {
+				t.Errorf("TestSimpleRename(%s): items changed to %d on error", test.desc, simple.items)
+			}
+			if diff := pretty.Compare(unchanged, paths(simple)); diff != "" {
+				t.Errorf("TestSimpleRename(%s): tree changed on error: -want/+got:\n%s", test.desc, diff)
+			}
+			continue
+		}
+
+		for name, content := range test.wantFiles {
+			b, err := simple.ReadFile(name)
+			if err != nil || string(b) != content {
+				t.Errorf("TestSimpleRename(%s): ReadFile(%s): got (%q, %v), want (%q, nil)", test.desc, name, string(b), err, content)
+			}
+		}
+		for _, name := range test.wantGone {
+			if _, err := simple.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("TestSimpleRename(%s): Stat(%s): got err == %v, want fs.ErrNotExist", test.desc, name, err)
+			}
+		}
+		if simple.items != 5 {
+			t.Errorf("TestSimpleRename(%s): got items == %d, want 5", test.desc, simple.items)
+		}
+		fs.WalkDir(simple, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			entries, _ := simple.ReadDir(p)
+			for j := 1; j < len(entries); j++ {
+				if entries[j-1].Name() >= entries[j].Name() {
+					t.Errorf("TestSimpleRename(%s): ReadDir(%s) is not sorted", test.desc, p)
+				}
+			}
+			return nil
+		})
+	}
+
+	simple := build()
+	simple.RO()
+	if err := simple.Rename("f.txt", "g.txt"); err == nil {
+		t.Errorf("TestSimpleRename(after RO): got err == nil, want err != nil")
+	}
+}
+
+func TestSimpleConform(t *testing.T) {
+	tests := []struct {
+		desc string
+		opts []SimpleOption
+		ro   bool
+	}{
+		{desc: "Default"},
+		{desc: "RO", ro: true},
+		{desc: "WithRWLock", opts: []SimpleOption{WithRWLock()}},
+		{desc: "WithStringInterning", opts: []SimpleOption{WithStringInterning()}},
+		{desc: "WithPearson", opts: []SimpleOption{WithPearson()}, ro: true},
+		{desc: "WithTrie", opts: []SimpleOption{WithTrie()}, ro: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var opts []jsfstest.Option
+			if test.ro {
+				opts = append(opts, jsfstest.WithRO())
+			}
+			jsfstest.Conform(t, func() fs.FS { return NewSimple(test.opts...) }, conformFiles, opts...)
+		})
+	}
+}
+
+func BenchmarkSimpleLookup(b *testing.B) {
+	const (
+		dirs     = 100
+		perDir   = 100
+		deepPath = "d50/s1/s2/s3/s4/s5/s6/s7/file50.txt"
+	)
+	build := func(opts ...SimpleOption) *Simple {
+		simple := NewSimple(opts...)
+		for i := 0; i < dirs; i++ {
+			for j := 0; j < perDir; j++ {
+				simple.WriteFile(fmt.Sprintf("d%d/file%d.txt", i, j), nil, 0660)
+			}
+		}
+		simple.WriteFile(deepPath, nil, 0660)
+		simple.RO()
+		return simple
+	}
+
+	systems := []struct {
+		desc   string
+		simple *Simple
+	}{
+		{"Tree walk", build()},
+		{"Pearson", build(WithPearson())},
+		{"Trie", build(WithTrie())},
+	}
+	paths := []struct {
+		desc string
+		path string
+	}{
+		{"Shallow", "d50/file50.txt"},
+		{"Deep", deepPath},
+	}
+
+	for _, p := range paths {
+		for _, sys := range systems {
+			b.Run(p.desc+"/"+sys.desc, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := sys.simple.lookup(p.path); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// MinifyWhitespace is a FileTransform that removes leading and trailing whitespace from every
+// line and drops empty lines. It is not aware of any file format, so don't use it on files where
+// whitespace is meaningful, such as Python, Makefiles or text inside <pre> tags.
+func MinifyWhitespace(name string, content []byte) ([]byte, error) {
+	out := make([]byte, 0, len(content))
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, line...)
+	}
+	return out, nil
+}
+
+// GzipTransform returns a FileTransform that gzip compresses the content at level, which is
+// one of the levels in compress/gzip, such as gzip.BestCompression. The content can be read
+// back with gzip.NewReader(). The file name is not changed, use WithResultTransform() if you
+// want to add a ".gz" suffix.
+func GzipTransform(level int) FileTransform {
+	return func(name string, content []byte) ([]byte, error) {
+		buf := bytes.Buffer{}
+		zw, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(content); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// ReplaceTransform returns a FileTransform that replaces all instances of old with new.
+// This is useful for stripping build-time paths out of generated files.
+func ReplaceTransform(old, new []byte) FileTransform {
+	return func(name string, content []byte) ([]byte, error) {
+		return bytes.ReplaceAll(content, old, new), nil
+	}
+}
@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestMinifyWhitespace(t *testing.T) {
+	in := "  <html>\r\n\t<body>  \n\n   \n\t\t<p>hello world</p>\n</body>\n</html>\n"
+	want := "<html>\n<body>\n<p>hello world</p>\n</body>\n</html>"
+
+	got, err := MinifyWhitespace("index.html", []byte(in))
+	if err != nil {
+		t.Fatalf("TestMinifyWhitespace: got err == %s, want err == nil", err)
+	}
+	if diff := pretty.Compare(want, string(got)); diff != "" {
+		t.Errorf("TestMinifyWhitespace: -want/+got:\n%s", diff)
+	}
+}
+
+func TestGzipTransform(t *testing.T) {
+	content := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 1000)
+
+	// Byte 8 of a gzip header (XFL) records if the best or fastest level was used.
+	tests := []struct {
+		desc    string
+		level   int
+		wantXFL byte
+		wantErr bool
+	}{
+		{desc: "BestCompression", level: gzip.BestCompression, wantXFL: 2},
+		{desc: "BestSpeed", level: gzip.BestSpeed, wantXFL: 4},
+		{desc: "Invalid level", level: 100, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := GzipTransform(test.level)("file.txt", content)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestGzipTransform(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestGzipTransform(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if got[8] != test.wantXFL {
+			t.Errorf("TestGzipTransform(%s): got XFL header %d, want %d", test.desc, got[8], test.wantXFL)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(got))
+		if err != nil {
+			t.Fatalf("TestGzipTransform(%s): gzip.NewReader(): got err == %s, want err == nil", test.desc, err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Errorf("TestGzipTransform(%s): decompressed content did not match, err == %v", test.desc, err)
+		}
+	}
+
+	none, _ := GzipTransform(gzip.NoCompression)("file.txt", content)
+	best, _ := GzipTransform(gzip.BestCompression)("file.txt", content)
+	if len(best) >= len(none) {
+		t.Errorf("TestGzipTransform: BestCompression was %d bytes, NoCompression was %d bytes, want BestCompression smaller", len(best), len(none))
+	}
+}
+
+func TestReplaceTransform(t *testing.T) {
+	in := "/home/builder/src/app/main.go:10\n/home/builder/src/app/util.go:20\n"
+	want := "app/main.go:10\napp/util.go:20\n"
+
+	got, err := ReplaceTransform([]byte("/home/builder/src/"), nil)("trace.txt", []byte(in))
+	if err != nil {
+		t.Fatalf("TestReplaceTransform: got err == %s, want err == nil", err)
+	}
+	if diff := pretty.Compare(want, string(got)); diff != "" {
+		t.Errorf("TestReplaceTransform: -want/+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// OpenSeeker opens name in fsys and returns it as an io.ReadSeekCloser, such as is needed
+// by http.ServeContent(). If the fs.File already implements io.Seeker it is returned as is.
+// Otherwise the whole content is read into memory and the file is closed, so this should
+// not be used on large files in file systems that can't Seek.
+func OpenSeeker(fsys fs.FS, name string) (io.ReadSeekCloser, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if rsc, ok := f.(io.ReadSeekCloser); ok {
+		return rsc, nil
+	}
+
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return bufferedSeeker{bytes.NewReader(b)}, nil
+}
+
+// bufferedSeeker adds a no-op Close() to a *bytes.Reader.
+type bufferedSeeker struct {
+	*bytes.Reader
+}
+
+func (bufferedSeeker) Close() error {
+	return nil
+}
+
+// CountFiles returns the number of files, not including directories, at or under root.
+func CountFiles(fsys fs.FS, root string) (int, error) {
+	n := 0
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// errStopWalk is used to stop fs.WalkDir() early, as fs.SkipAll isn't in our minimum Go version.
+var errStopWalk = errors.New("stop walk")
+
+// Any reports if pred returns true for any file or directory at or under root. The walk
+// stops at the first match.
+func Any(fsys fs.FS, root string, pred func(path string, d fs.DirEntry) bool) (bool, error) {
+	found := false
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if pred(p, d) {
+			found = true
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return false, err
+	}
+	return found, nil
+}
+
+// ReadHeader returns the first n bytes of the file at name, or the whole file if it is
+// shorter. Only what is needed is read and the file is never seeked, so this works on any
+// fs.FS and is useful for content type sniffing or checking magic bytes.
+func ReadHeader(fsys fs.FS, name string, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, n)
+	read, err := io.ReadFull(f, b)
+	switch err {
+	case nil, io.EOF, io.ErrUnexpectedEOF:
+		return b[:read], nil
+	}
+	return nil, err
+}
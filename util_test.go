@@ -0,0 +1,197 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamFS returns files that only support Read, Stat and Close.
+type streamFS struct {
+	fsys fs.FS
+}
+
+type streamFile struct {
+	f fs.File
+}
+
+func (s streamFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return streamFile{f}, nil
+}
+
+func (s streamFile) Read(b []byte) (int, error) { return s.f.Read(b) }
+func (s streamFile) Stat() (fs.FileInfo, error) { return s.f.Stat() }
+func (s streamFile) Close() error               { return s.f.Close() }
+
+func TestOpenSeeker(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		fsys     fs.FS
+		buffered bool
+	}{
+		{desc: "Native seek", fsys: os.DirFS(dir)},
+		{desc: "Buffered fallback", fsys: streamFS{os.DirFS(dir)}, buffered: true},
+	}
+
+	for _, test := range tests {
+		rsc, err := OpenSeeker(test.fsys, "file.txt")
+		if err != nil {
+			t.Errorf("TestOpenSeeker(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if _, ok := rsc.(bufferedSeeker); ok != test.buffered {
+			t.Errorf("TestOpenSeeker(%s): got buffered == %v, want %v", test.desc, ok, test.buffered)
+		}
+
+		if _, err := rsc.Seek(6, io.SeekStart); err != nil {
+			t.Errorf("TestOpenSeeker(%s): Seek(): got err == %s, want err == nil", test.desc, err)
+		}
+		b, err := io.ReadAll(rsc)
+		if err != nil || string(b) != "world" {
+			t.Errorf("TestOpenSeeker(%s): got (%q, %v), want ('world', nil)", test.desc, string(b), err)
+		}
+		if _, err := rsc.Seek(-5, io.SeekEnd); err != nil {
+			t.Errorf("TestOpenSeeker(%s): Seek(SeekEnd): got err == %s, want err == nil", test.desc, err)
+		}
+		b, _ = io.ReadAll(rsc)
+		if string(b) != "world" {
+			t.Errorf("TestOpenSeeker(%s): after SeekEnd got %q, want 'world'", test.desc, string(b))
+		}
+		if err := rsc.Close(); err != nil {
+			t.Errorf("TestOpenSeeker(%s): Close(): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+
+	if _, err := OpenSeeker(os.DirFS(dir), "nope.txt"); err == nil {
+		t.Errorf("TestOpenSeeker(missing file): got err == nil, want err != nil")
+	}
+}
+
+func TestCountFilesAndAny(t *testing.T) {
+	fsys := MapFS(map[string][]byte{
+		"a/1.txt":   nil,
+		"a/2.txt":   nil,
+		"a/b/3.txt": nil,
+		"c/4.txt":   nil,
+	})
+
+	counts := []struct {
+		root    string
+		want    int
+		wantErr bool
+	}{
+		{root: ".", want: 4},
+		{root: "a", want: 3},
+		{root: "a/b/3.txt", want: 1},
+		{root: "none", wantErr: true},
+	}
+	for _, test := range counts {
+		got, err := CountFiles(fsys, test.root)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestCountFilesAndAny(CountFiles(%s)): got err == nil, want err != nil", test.root)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestCountFilesAndAny(CountFiles(%s)): got err == %s, want err == nil", test.root, err)
+		case got != test.want:
+			t.Errorf("TestCountFilesAndAny(CountFiles(%s)): got %d, want %d", test.root, got, test.want)
+		}
+	}
+
+	calls := 0
+	isFile := func(p string, d fs.DirEntry) bool {
+		calls++
+		return !d.IsDir()
+	}
+	found, err := Any(fsys, "a", isFile)
+	if err != nil || !found {
+		t.Fatalf("TestCountFilesAndAny(Any(a)): got (%v, %v), want (true, nil)", found, err)
+	}
+	// "a" is visited, then "a/1.txt" matches and the walk stops.
+	if calls != 2 {
+		t.Errorf("TestCountFilesAndAny(Any(a)): predicate called %d times, want 2", calls)
+	}
+
+	found, err = Any(fsys, ".", func(p string, d fs.DirEntry) bool { return p == "none.txt" })
+	if err != nil || found {
+		t.Errorf("TestCountFilesAndAny(Any(no match)): got (%v, %v), want (false, nil)", found, err)
+	}
+}
+
+// countFS counts the bytes read from files opened through it.
+type countFS struct {
+	fsys fs.FS
+	read int
+}
+
+type countFile struct {
+	fs.File
+	c *countFS
+}
+
+func (c *countFS) Open(name string) (fs.File, error) {
+	f, err := c.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countFile{File: f, c: c}, nil
+}
+
+func (c countFile) Read(b []byte) (int, error) {
+	n, err := c.File.Read(b)
+	c.c.read += n
+	return n, err
+}
+
+func TestReadHeader(t *testing.T) {
+	content := "0123456789"
+
+	tests := []struct {
+		desc    string
+		n       int
+		want    string
+		wantErr bool
+	}{
+		{desc: "Less than the file", n: 4, want: "0123"},
+		{desc: "Exactly the file", n: 10, want: content},
+		{desc: "More than the file", n: 100, want: content},
+		{desc: "Zero", n: 0, want: ""},
+		{desc: "Negative", n: -1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		fsys := &countFS{fsys: MapFS(map[string][]byte{"file.txt": []byte(content)})}
+		got, err := ReadHeader(fsys, "file.txt", test.n)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestReadHeader(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestReadHeader(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("TestReadHeader(%s): got %q, want %q", test.desc, string(got), test.want)
+		}
+		if fsys.read != len(test.want) {
+			t.Errorf("TestReadHeader(%s): read %d bytes from the file, want %d", test.desc, fsys.read, len(test.want))
+		}
+	}
+
+	if _, err := ReadHeader(MapFS(nil), "none.txt", 4); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestReadHeader(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}